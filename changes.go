@@ -0,0 +1,144 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+type TaskChange struct {
+	TaskID           string
+	Name             string `json:",omitempty"`
+	Zones            []string
+	Status           string
+	OldStartDatetime *time.Time `json:",omitempty"`
+	OldEndDatetime   *time.Time `json:",omitempty"`
+	NewStartDatetime *time.Time `json:",omitempty"`
+	NewEndDatetime   *time.Time `json:",omitempty"`
+}
+
+// Changes groups what a scheduling operation did to the schedule
+type Changes struct {
+	Placed     []TaskChange // tasks the operation was about
+	Displaced  []TaskChange // other tasks moved to another slot
+	Compressed []TaskChange // per-zone tasks split from displaced tasks with compression
+	Cancelled  []TaskChange // tasks that lost their slot
+}
+
+func scheduledTaskIds(scheduleZones map[string]*zoneIndex) map[string]bool {
+	scheduled := make(map[string]bool)
+	for _, zoneSchedule := range scheduleZones {
+		for taskId := range zoneSchedule.spans {
+			scheduled[taskId] = true
+		}
+	}
+	return scheduled
+}
+
+func newTaskChange(task Task) TaskChange {
+	return TaskChange{
+		TaskID: task.ID,
+		Name:   task.Name,
+		Zones:  task.Zones,
+		Status: task.Status,
+	}
+}
+
+func (change *TaskChange) setOld(task Task) {
+	start, end := task.StartDatetime, task.StartDatetime.Add(task.Duration)
+	change.OldStartDatetime, change.OldEndDatetime = &start, &end
+}
+
+func (change *TaskChange) setNew(task Task) {
+	start, end := task.StartDatetime, task.StartDatetime.Add(task.Duration)
+	change.NewStartDatetime, change.NewEndDatetime = &start, &end
+}
+
+// diffState compares current schedule with the snapshot taken before an operation;
+// subjects are the tasks the operation was requested for
+func diffState(before stateSnapshot, subjects ...string) Changes {
+	changes := Changes{}
+	isSubject := make(map[string]bool)
+	for _, taskId := range subjects {
+		isSubject[taskId] = true
+	}
+	scheduledBefore := scheduledTaskIds(before.schedule)
+	scheduledAfter := scheduledTaskIds(schedule)
+
+	taskIds := []string{}
+	for taskId := range tasks {
+		taskIds = append(taskIds, taskId)
+	}
+	for taskId := range before.tasks {
+		if _, ok := tasks[taskId]; !ok {
+			taskIds = append(taskIds, taskId)
+		}
+	}
+	sort.Strings(taskIds)
+
+	for _, taskId := range taskIds {
+		oldTask, existed := before.tasks[taskId]
+		newTask, exists := tasks[taskId]
+		if isSubject[taskId] {
+			if !exists {
+				continue
+			}
+			change := newTaskChange(*newTask)
+			if existed && scheduledBefore[taskId] {
+				change.setOld(oldTask)
+			}
+			if scheduledAfter[taskId] {
+				change.setNew(*newTask)
+				changes.Placed = append(changes.Placed, change)
+			} else {
+				changes.Cancelled = append(changes.Cancelled, change)
+			}
+			continue
+		}
+		switch {
+		case !existed && exists && scheduledAfter[taskId]:
+			// only displaced tasks are split into new per-zone tasks
+			change := newTaskChange(*newTask)
+			change.setNew(*newTask)
+			if newTask.CompressionPerc > 0 {
+				changes.Compressed = append(changes.Compressed, change)
+			} else {
+				changes.Displaced = append(changes.Displaced, change)
+			}
+		case existed && scheduledBefore[taskId] && !scheduledAfter[taskId]:
+			change := newTaskChange(oldTask)
+			if exists {
+				change.Status = newTask.Status
+			}
+			change.setOld(oldTask)
+			changes.Cancelled = append(changes.Cancelled, change)
+		case existed && scheduledBefore[taskId] && scheduledAfter[taskId]:
+			if oldTask.StartDatetime.Equal(newTask.StartDatetime) && oldTask.Duration == newTask.Duration {
+				continue
+			}
+			change := newTaskChange(*newTask)
+			change.setOld(oldTask)
+			change.setNew(*newTask)
+			changes.Displaced = append(changes.Displaced, change)
+		}
+	}
+	return changes
+}
+
+// touchTasks bumps Revision and UpdatedAt of tasks whose slot, status or name changed since the snapshot;
+// new tasks start with Revision 0
+func touchTasks(before stateSnapshot, now time.Time) {
+	for taskId, task := range tasks {
+		oldTask, existed := before.tasks[taskId]
+		if !existed {
+			task.UpdatedAt = now
+			continue
+		}
+		if oldTask.Name == task.Name && oldTask.Status == task.Status && oldTask.StartDatetime.Equal(task.StartDatetime) &&
+			oldTask.Duration == task.Duration && strings.Join(oldTask.Zones, ",") == strings.Join(task.Zones, ",") {
+			continue
+		}
+		task.Revision++
+		task.UpdatedAt = now
+	}
+}
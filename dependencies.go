@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// Dependency is a finish-to-start constraint: the task starts at least Lag after TaskID ends
+type Dependency struct {
+	TaskID string
+	Lag    time.Duration `json:",omitempty"`
+}
+
+func dependenciesFromReq(dependencyReqs []DependencyReq) ([]Dependency, error) {
+	dependencies := []Dependency{}
+	for _, dependencyReq := range dependencyReqs {
+		dependency := Dependency{TaskID: dependencyReq.TaskID}
+		if dependencyReq.Lag != "" {
+			lag, err := time.ParseDuration(dependencyReq.Lag)
+			if err != nil {
+				return nil, err
+			}
+			if lag < 0 {
+				return nil, newAPIError(codeInvalidRequest, "lag of dependency %s can't be negative", dependencyReq.TaskID)
+			}
+			dependency.Lag = lag
+		}
+		dependencies = append(dependencies, dependency)
+	}
+	return dependencies, nil
+}
+
+// dependencyEnd is the (planned or actual) end of the task; a split or rollout task ends with its last per-zone task
+func dependencyEnd(taskID string) (time.Time, error) {
+	task, ok := tasks[taskID]
+	if !ok {
+		return time.Time{}, &APIError{Code: codeDependencyUnavailable, Message: fmt.Sprintf("no dependency task with ID %s", taskID), TaskIDs: []string{taskID}}
+	}
+	switch {
+	case task.Status == "cancel" || task.Status == "failed" || task.Status == "paused":
+		return time.Time{}, &APIError{Code: codeDependencyUnavailable, Message: fmt.Sprintf("dependency task %s is %s", taskID, task.Status), TaskIDs: []string{taskID}}
+	case task.Status == "complete":
+		if task.ActualEndDatetime != nil {
+			return *task.ActualEndDatetime, nil
+		}
+	case len(task.Children) > 0:
+		end := time.Time{}
+		for _, childID := range task.Children {
+			childEnd, err := dependencyEnd(childID)
+			if err != nil {
+				continue
+			}
+			if childEnd.After(end) {
+				end = childEnd
+			}
+		}
+		if end.IsZero() {
+			return end, &APIError{Code: codeDependencyUnavailable, Message: fmt.Sprintf("dependency task %s has no active per-zone tasks", taskID), TaskIDs: []string{taskID}}
+		}
+		return end, nil
+	}
+	return task.StartDatetime.Add(task.Duration), nil
+}
+
+// earliestStart is the earliest start of the task allowed by its dependencies
+func earliestStart(task Task) (time.Time, error) {
+	earliest := time.Time{}
+	for _, dependency := range task.Dependencies {
+		end, err := dependencyEnd(dependency.TaskID)
+		if err != nil {
+			return earliest, err
+		}
+		if end.Add(dependency.Lag).After(earliest) {
+			earliest = end.Add(dependency.Lag)
+		}
+	}
+	return earliest, nil
+}
+
+func checkDependencies(task *Task) error {
+	for _, dependency := range task.Dependencies {
+		end, err := dependencyEnd(dependency.TaskID)
+		if err != nil {
+			return err
+		}
+		if task.StartDatetime.Before(end.Add(dependency.Lag)) {
+			return &APIError{
+				Code:    codeDependencyViolated,
+				Message: fmt.Sprintf("task %s can't start before %v: dependency %s ends at %v with lag %v", task.ID, end.Add(dependency.Lag), dependency.TaskID, end, dependency.Lag),
+				TaskIDs: []string{dependency.TaskID},
+			}
+		}
+	}
+	return nil
+}
+
+// dependencyDone tells if the task (all per-zone tasks of a split or rollout task) has completed
+func dependencyDone(taskID string) bool {
+	task, ok := tasks[taskID]
+	if !ok {
+		return false
+	}
+	if len(task.Children) == 0 {
+		return task.Status == "complete"
+	}
+	done := false
+	for _, childID := range task.Children {
+		child, ok := tasks[childID]
+		if !ok || child.Status == "cancel" {
+			continue
+		}
+		if child.Status != "complete" {
+			return false
+		}
+		done = true
+	}
+	return done
+}
+
+// pendingDependency returns the first dependency of the task that hasn't completed
+func pendingDependency(task *Task) string {
+	for _, dependency := range task.Dependencies {
+		if !dependencyDone(dependency.TaskID) {
+			return dependency.TaskID
+		}
+	}
+	return ""
+}
+
+// dependents returns tasks depending on any of taskIDs, ordered by ID
+func dependents(taskIDs ...string) []*Task {
+	isDependency := make(map[string]bool)
+	for _, taskID := range taskIDs {
+		isDependency[taskID] = true
+	}
+	found := []*Task{}
+	for _, task := range tasks {
+		for _, dependency := range task.Dependencies {
+			if isDependency[dependency.TaskID] {
+				found = append(found, task)
+				break
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].ID < found[j].ID
+	})
+	return found
+}
+
+func isScheduled(taskID string) bool {
+	for _, zone := range tasks[taskID].Zones {
+		if schedule[zone].contains(taskID) {
+			return true
+		}
+	}
+	return false
+}
+
+// placeAfterDependencies moves the waiting task to the earliest slot after its dependencies end
+func placeAfterDependencies(task *Task) error {
+	earliest, err := earliestStart(*task)
+	if err != nil {
+		return err
+	}
+	if !task.StartDatetime.Before(earliest) {
+		return nil
+	}
+	recordTask(task.ID)
+	task.StartDatetime = roundStart(task.Type, earliest)
+	if placeEarliest(task) {
+		log.Debug(fmt.Sprintf("Moved task %s after its dependencies to %v", task.ID, task.StartDatetime))
+		return nil
+	}
+	return &APIError{
+		Code:    codeDependencyViolated,
+		Message: fmt.Sprintf("can't place task %s after its dependencies before its deadline %v", task.ID, task.Deadline),
+		TaskIDs: []string{task.ID},
+	}
+}
+
+// placeEarliest schedules the task in the first slot from its start that fits all its zones
+func placeEarliest(task *Task) bool {
+	recordTask(task.ID)
+	for _, candidate := range alignedCandidates(*task, candidatePoints(*task)) {
+		task.StartDatetime = candidate.StartDatetime
+		if scheduleTask(task, "wait") == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// cascadeDependents moves waiting dependents of the task that would start before it ends
+func cascadeDependents(taskID string) error {
+	taskIDs := []string{taskID}
+	if parentID := tasks[taskID].ParentID; parentID != "" {
+		taskIDs = append(taskIDs, parentID)
+	}
+	for _, dependent := range dependents(taskIDs...) {
+		if dependent.Status != "wait" || !isScheduled(dependent.ID) {
+			continue
+		}
+		if err := placeAfterDependencies(dependent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// activeDependents lists tasks in wait or progress that depend on the task
+func activeDependents(taskID string) []string {
+	active := []string{}
+	for _, dependent := range dependents(taskID) {
+		if dependent.Status == "wait" || dependent.Status == "progress" {
+			active = append(active, dependent.ID)
+		}
+	}
+	return active
+}
+
+// createsCycle tells if the task depending on dependencies would be reachable from itself
+func createsCycle(taskID string, dependencies []Dependency) bool {
+	visited := make(map[string]bool)
+	stack := []string{}
+	for _, dependency := range dependencies {
+		stack = append(stack, dependency.TaskID)
+	}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if current == taskID {
+			return true
+		}
+		if visited[current] {
+			continue
+		}
+		visited[current] = true
+		if task, ok := tasks[current]; ok {
+			for _, dependency := range task.Dependencies {
+				stack = append(stack, dependency.TaskID)
+			}
+		}
+	}
+	return false
+}
+
+// topologicalOrder orders task IDs so that dependencies come first, otherwise by taskOrderLess;
+// a split or rollout dependency stands for its per-zone tasks
+func topologicalOrder(taskIDs []string) []string {
+	byTaskOrder := func(ids []string) {
+		sort.Slice(ids, func(i, j int) bool {
+			return taskOrderLess(tasks[ids[i]], tasks[ids[j]])
+		})
+	}
+	pending := make(map[string]int)
+	for _, taskID := range taskIDs {
+		pending[taskID] = 0
+	}
+	next := make(map[string][]string)
+	for _, taskID := range taskIDs {
+		for _, dependency := range tasks[taskID].Dependencies {
+			dependencyIDs := []string{dependency.TaskID}
+			if dependencyTask, ok := tasks[dependency.TaskID]; ok && len(dependencyTask.Children) > 0 {
+				dependencyIDs = dependencyTask.Children
+			}
+			for _, dependencyID := range dependencyIDs {
+				if _, ok := pending[dependencyID]; ok {
+					pending[taskID]++
+					next[dependencyID] = append(next[dependencyID], taskID)
+				}
+			}
+		}
+	}
+	ready := []string{}
+	for taskID, count := range pending {
+		if count == 0 {
+			ready = append(ready, taskID)
+		}
+	}
+	ordered := []string{}
+	for len(ready) > 0 {
+		byTaskOrder(ready)
+		taskID := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, taskID)
+		for _, nextID := range next[taskID] {
+			pending[nextID]--
+			if pending[nextID] == 0 {
+				ready = append(ready, nextID)
+			}
+		}
+		delete(pending, taskID)
+	}
+	// tasks left in a dependency cycle go last
+	left := []string{}
+	for taskID := range pending {
+		left = append(left, taskID)
+	}
+	byTaskOrder(left)
+	return append(ordered, left...)
+}
+
+func setDependencies(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	var setDependenciesReq SetDependenciesReq
+	reqBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		log.Warn(err)
+		return
+	}
+	json.Unmarshal(reqBody, &setDependenciesReq)
+	dependencies, err := dependenciesFromReq(setDependenciesReq.Dependencies)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		log.Warn(err)
+		return
+	}
+
+	taskID := mux.Vars(r)["uuid"]
+	var resp []byte
+	apply := func() error {
+		task, ok := tasks[taskID]
+		if !ok {
+			return newAPIError(codeTaskNotFound, "No task with this ID %s", taskID)
+		}
+		if task.Status != "wait" {
+			return newAPIError(codeInvalidStatus, "Can only change dependencies of tasks in wait %s", taskID)
+		}
+		if createsCycle(taskID, dependencies) {
+			return newAPIError(codeDependencyCycle, "dependencies of task %s would form a cycle", taskID)
+		}
+		task.Dependencies = dependencies
+		err := placeAfterDependencies(task)
+		if err != nil {
+			return err
+		}
+		resp, err = json.Marshal(inRequestLocation(r, newTaskResp(task)))
+		return err
+	}
+	if isDryRun(r) {
+		writeDryRun(w, r, apply, &resp, taskID)
+		return
+	}
+	err = engine.Update(apply)
+	if err != nil {
+		updateError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info("Changed dependencies of task ", taskID)
+}
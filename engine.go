@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync"
+)
+
+// Engine serializes access to tasks, schedule and config: mutations run one at a time under the write lock,
+// readers share the read lock and never observe a half-executed Order
+type Engine struct {
+	mu     sync.RWMutex
+	before stateSnapshot // state the running update started from
+}
+
+var engine = &Engine{}
+
+type persistError struct {
+	err error
+}
+
+func (e *persistError) Error() string {
+	return e.err.Error()
+}
+
+func (e *persistError) Unwrap() error {
+	return e.err
+}
+
+// Update runs fn exclusively and persists the state if fn succeeds; if fn or persisting fails, the state is rolled back
+func (e *Engine) Update(fn func() error) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	preemptionLog = nil
+	e.before = snapshotState()
+	defer func() {
+		e.before = stateSnapshot{}
+	}()
+	if err := fn(); err != nil {
+		restoreState(e.before)
+		return err
+	}
+	touchTasks(e.before, clock.Now())
+	if err := persistState(); err != nil {
+		restoreState(e.before)
+		return &persistError{err: err}
+	}
+	return nil
+}
+
+// Changes is what the running update has changed so far; fn of Update can call it to report them
+func (e *Engine) Changes() Changes {
+	return diffState(e.before)
+}
+
+// Simulate runs fn exclusively like Update but always rolls the state back, returning what fn would have changed;
+// subjects, if given, are called after fn for the tasks it was requested for
+func (e *Engine) Simulate(fn func() error, subjects func() []string) (Changes, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	preemptionLog = nil
+	snapshot := snapshotState()
+	defer restoreState(snapshot)
+	if err := fn(); err != nil {
+		return Changes{}, err
+	}
+	if subjects == nil {
+		return diffState(snapshot), nil
+	}
+	return diffState(snapshot, subjects()...), nil
+}
+
+// Close waits for the running update and closes the store
+func (e *Engine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return store.Close()
+}
+
+// View runs fn with a consistent read-only view of the state
+func (e *Engine) View(fn func()) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	fn()
+}
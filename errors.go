@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// error codes returned in APIError.Code
+const (
+	codeInvalidRequest         = "INVALID_REQUEST"
+	codeInternal               = "INTERNAL_ERROR"
+	codeStore                  = "STORE_ERROR"
+	codeTaskNotFound           = "TASK_NOT_FOUND"
+	codeInvalidStatus          = "INVALID_STATUS"
+	codePastStart              = "PAST_START"
+	codeDeadlineBeforeEnd      = "DEADLINE_BEFORE_END"
+	codeDeadlineTooFar         = "DEADLINE_TOO_FAR"
+	codeDurationTooShort       = "DURATION_TOO_SHORT"
+	codeDurationTooLong        = "DURATION_TOO_LONG"
+	codeUnknownZone            = "UNKNOWN_ZONE"
+	codeZoneBlacklisted        = "ZONE_BLACKLISTED"
+	codeOutsideWhitelist       = "OUTSIDE_WHITELIST"
+	codeWindowBlocked          = "WINDOW_BLOCKED"
+	codeAvailableZonesViolated = "AVAILABLE_ZONES_VIOLATED"
+	codeOverlap                = "OVERLAP"
+	codeDisplacementFailed     = "DISPLACEMENT_FAILED"
+	codeExecutorConflict       = "EXECUTOR_CONFLICT"
+	codeDependencyUnavailable  = "DEPENDENCY_UNAVAILABLE"
+	codeDependencyViolated     = "DEPENDENCY_VIOLATED"
+	codeDependencyCycle        = "DEPENDENCY_CYCLE"
+	codeHasDependents          = "HAS_DEPENDENTS"
+	codeStageUnplaceable       = "STAGE_UNPLACEABLE"
+	codeSeriesNotFound         = "SERIES_NOT_FOUND"
+	codeZoneFrozen             = "ZONE_FROZEN"
+	codeFreezeNotFound         = "FREEZE_NOT_FOUND"
+	codePlanNotFound           = "PLAN_NOT_FOUND"
+	codePlanStale              = "PLAN_STALE"
+	codeReportNotFound         = "REPORT_NOT_FOUND"
+)
+
+type Suggestion struct {
+	Zone          string
+	StartDatetime time.Time
+	EndDatetime   time.Time
+}
+
+// APIError is the JSON body of every error response
+type APIError struct {
+	Code        string
+	Message     string
+	Zone        string       `json:",omitempty"`
+	TaskIDs     []string     `json:",omitempty"` // conflicting tasks
+	Suggestions []Suggestion `json:",omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+func newAPIError(code string, format string, args ...interface{}) *APIError {
+	return &APIError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// asAPIError finds APIError in err chain keeping the full message of wrapping errors
+func asAPIError(err error, defaultCode string) *APIError {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return &APIError{Code: defaultCode, Message: err.Error()}
+	}
+	wrapped := *apiErr
+	wrapped.Message = err.Error()
+	return &wrapped
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	defaultCode := codeInvalidRequest
+	if status >= http.StatusInternalServerError {
+		defaultCode = codeInternal
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(asAPIError(err, defaultCode))
+}
+
+// withSuggestions attaches alternative timespans for the rejected task
+func withSuggestions(err error, task Task) error {
+	apiErr := asAPIError(err, codeInvalidRequest)
+	points := suggestTime(task)
+	for zone, point := range points {
+		apiErr.Suggestions = append(apiErr.Suggestions, Suggestion{
+			Zone:          zone,
+			StartDatetime: point,
+			EndDatetime:   point.Add(task.Duration),
+		})
+	}
+	sort.Slice(apiErr.Suggestions, func(i, j int) bool {
+		return apiErr.Suggestions[i].Zone < apiErr.Suggestions[j].Zone
+	})
+	return apiErr
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// failingStore fails every save like a full disk
+type failingStore struct {
+	memoryStore
+}
+
+func (s *failingStore) Save(state State) error {
+	return errors.New("no space left on device")
+}
+
+func decodeAPIError(t *testing.T, w *httptest.ResponseRecorder, status int) APIError {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("returned %d %s, want %d", w.Code, w.Body.String(), status)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Fatalf("Content-Type is %q", contentType)
+	}
+	var apiErr APIError
+	if err := json.Unmarshal(w.Body.Bytes(), &apiErr); err != nil {
+		t.Fatalf("error body %s: %v", w.Body.String(), err)
+	}
+	if apiErr.Message == "" {
+		t.Fatalf("error %s has no message", w.Body.String())
+	}
+	return apiErr
+}
+
+func TestAddTaskErrorCodes(t *testing.T) {
+	cases := []struct {
+		name  string
+		setup func()
+		body  string // fields of the request besides Name and Type
+		code  string
+		zone  string
+	}{
+		{name: "past start", body: `"Zones": ["dev1"], "Duration": "1h", "StartDatetime": "06/01/2030 23:00", "Deadline": "08/01/2030 00:00"`, code: codePastStart},
+		{name: "deadline before end", body: `"Zones": ["dev1"], "Duration": "1h", "StartDatetime": "07/01/2030 01:00", "Deadline": "07/01/2030 01:30"`, code: codeDeadlineBeforeEnd},
+		{name: "deadline too far", body: `"Zones": ["dev1"], "Duration": "1h", "StartDatetime": "07/01/2030 01:00", "Deadline": "07/03/2030 00:00"`, code: codeDeadlineTooFar},
+		{name: "no zones", body: `"Duration": "1h", "StartDatetime": "07/01/2030 01:00", "Deadline": "08/01/2030 00:00"`, code: codeInvalidRequest},
+		{
+			name:  "duration too short",
+			setup: func() { durations.MinManualDuration = 30 * time.Minute },
+			body:  `"Zones": ["dev1"], "Duration": "10m", "StartDatetime": "07/01/2030 01:00", "Deadline": "08/01/2030 00:00"`,
+			code:  codeDurationTooShort,
+		},
+		{name: "unknown zone", body: `"Zones": ["dev1", "dev9"], "Duration": "1h", "StartDatetime": "07/01/2030 01:00", "Deadline": "08/01/2030 00:00"`, code: codeUnknownZone, zone: "dev9"},
+		{
+			name:  "blacklisted zone",
+			setup: func() { config.BlackList = []string{"prod1"} },
+			body:  `"Zones": ["prod1"], "Duration": "1h", "StartDatetime": "07/01/2030 01:00", "Deadline": "08/01/2030 00:00"`,
+			code:  codeZoneBlacklisted,
+			zone:  "prod1",
+		},
+		{
+			name:  "outside whitelist",
+			setup: func() { config.WhiteListRaw["dev2"] = []string{"00:00-06:00"} },
+			body:  `"Zones": ["dev1", "dev2"], "Duration": "1h", "StartDatetime": "07/01/2030 10:00", "Deadline": "08/01/2030 00:00"`,
+			code:  codeOutsideWhitelist,
+			zone:  "dev2",
+		},
+		{
+			name:  "blocked window",
+			setup: func() { config.WhiteListRaw["dev2"] = []string{"00:00-23:59", "Mon 09:00-12:00 blocked"} },
+			body:  `"Zones": ["dev2"], "Duration": "1h", "StartDatetime": "07/01/2030 10:00", "Deadline": "08/01/2030 00:00"`,
+			code:  codeWindowBlocked,
+			zone:  "dev2",
+		},
+		{
+			name: "frozen zone",
+			setup: func() {
+				freezes["f"] = &Freeze{ID: "f", Name: "release", Zones: []string{"dev1"}, Start: testStart, End: testStart.Add(6 * time.Hour), Source: "api"}
+			},
+			body: `"Zones": ["dev1"], "Duration": "1h", "StartDatetime": "07/01/2030 01:00", "Deadline": "08/01/2030 00:00"`,
+			code: codeZoneFrozen,
+			zone: "dev1",
+		},
+		{
+			name:  "available zones",
+			setup: func() { config.AvailableZones = 2 },
+			body:  `"Zones": ["dev1"], "Duration": "1h", "StartDatetime": "07/01/2030 01:00", "Deadline": "08/01/2030 00:00"`,
+			code:  codeAvailableZonesViolated,
+			zone:  "dev1",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			setupState(t, "dev1", "dev2")
+			if c.setup != nil {
+				c.setup()
+			}
+			if err := loadWhiteList(); err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			body := fmt.Sprintf(`{"Name": "task", "Type": "manual", %s}`, c.body)
+			addTask(w, httptest.NewRequest("POST", "/tasks", strings.NewReader(body)))
+			apiErr := decodeAPIError(t, w, http.StatusBadRequest)
+			if apiErr.Code != c.code || apiErr.Zone != c.zone {
+				t.Fatalf("returned %s in zone %q (%s), want %s in zone %q", apiErr.Code, apiErr.Zone, apiErr.Message, c.code, c.zone)
+			}
+			if len(tasks) != 0 {
+				t.Fatalf("rejected task is kept: %v", tasks)
+			}
+		})
+	}
+}
+
+func TestAddTaskOverlapError(t *testing.T) {
+	setupState(t, "dev1")
+	placeTestTask(newTestTask("m", "manual", testStart.Add(time.Hour), time.Hour, "dev1"))
+	w := httptest.NewRecorder()
+	body := `{"Name": "task", "Type": "manual", "Zones": ["dev1"], "Duration": "1h", "StartDatetime": "07/01/2030 01:30", "Deadline": "08/01/2030 00:00"}`
+	addTask(w, httptest.NewRequest("POST", "/tasks?tz=Asia/Tokyo", strings.NewReader(body)))
+	apiErr := decodeAPIError(t, w, http.StatusBadRequest)
+	if apiErr.Code != codeOverlap || apiErr.Zone != "dev1" || len(apiErr.TaskIDs) != 1 || apiErr.TaskIDs[0] != "m" {
+		t.Fatalf("returned %+v, want %s with the conflicting task", apiErr, codeOverlap)
+	}
+	// the first start after the conflicting task and its pause
+	if len(apiErr.Suggestions) != 1 || apiErr.Suggestions[0].Zone != "dev1" || !apiErr.Suggestions[0].StartDatetime.Equal(testStart.Add(2*time.Hour+5*time.Minute)) {
+		t.Fatalf("suggestions are %+v", apiErr.Suggestions)
+	}
+}
+
+func TestNotFoundErrorCodes(t *testing.T) {
+	setupState(t, "dev1")
+	w := httptest.NewRecorder()
+	getTask(w, mux.SetURLVars(httptest.NewRequest("GET", "/tasks/missing", nil), map[string]string{"uuid": "missing"}))
+	if apiErr := decodeAPIError(t, w, http.StatusBadRequest); apiErr.Code != codeTaskNotFound {
+		t.Fatalf("returned %s, want %s", apiErr.Code, codeTaskNotFound)
+	}
+	w = httptest.NewRecorder()
+	getSeries(w, mux.SetURLVars(httptest.NewRequest("GET", "/series/missing", nil), map[string]string{"uuid": "missing"}))
+	if apiErr := decodeAPIError(t, w, http.StatusBadRequest); apiErr.Code != codeSeriesNotFound {
+		t.Fatalf("returned %s, want %s", apiErr.Code, codeSeriesNotFound)
+	}
+}
+
+func TestStoreErrorCode(t *testing.T) {
+	setupState(t, "dev1")
+	store = &failingStore{}
+	w := httptest.NewRecorder()
+	body := `{"Name": "task", "Type": "manual", "Zones": ["dev1"], "Duration": "1h", "StartDatetime": "07/01/2030 01:00", "Deadline": "08/01/2030 00:00"}`
+	addTask(w, httptest.NewRequest("POST", "/tasks", strings.NewReader(body)))
+	if apiErr := decodeAPIError(t, w, http.StatusInternalServerError); apiErr.Code != codeStore {
+		t.Fatalf("returned %s, want %s", apiErr.Code, codeStore)
+	}
+	if len(tasks) != 0 || schedule["dev1"].len() != 0 {
+		t.Fatal("task that wasn't persisted is kept")
+	}
+}
+
+func TestAsAPIError(t *testing.T) {
+	wrapped := fmt.Errorf("task a: %w", newAPIError(codeOverlap, "overlap in zone dev1"))
+	if apiErr := asAPIError(wrapped, codeInternal); apiErr.Code != codeOverlap || apiErr.Message != "task a: overlap in zone dev1" {
+		t.Errorf("wrapped error is %+v, want %s with the full message", apiErr, codeOverlap)
+	}
+	if apiErr := asAPIError(errors.New("parse error"), codeInvalidRequest); apiErr.Code != codeInvalidRequest || apiErr.Message != "parse error" {
+		t.Errorf("plain error is %+v, want the default code", apiErr)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// nextDueAutoTask returns the earliest unclaimed auto task in zone whose start time has come and whose dependencies completed
+func nextDueAutoTask(zone string, now time.Time) *Task {
+	due := []*Task{}
+	for _, task := range tasks {
+		if task.Type != "auto" || task.Executor != "" || task.StartDatetime.After(now) {
+			continue
+		}
+		if !task.StartDatetime.Add(task.Duration).After(now) { // failed by the lifecycle on its next tick
+			continue
+		}
+		if pendingDependency(task) != "" { // held in wait by the lifecycle too
+			continue
+		}
+		if task.Status != "wait" && task.Status != "progress" {
+			continue
+		}
+		for _, taskZone := range task.Zones {
+			if taskZone == zone {
+				due = append(due, task)
+				break
+			}
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].StartDatetime.Equal(due[j].StartDatetime) {
+			return due[i].StartDatetime.Before(due[j].StartDatetime)
+		}
+		return due[i].ID < due[j].ID
+	})
+	return due[0]
+}
+
+func claimedTask(taskID string, executor string) (*Task, error) {
+	task, ok := tasks[taskID]
+	if !ok {
+		return nil, newAPIError(codeTaskNotFound, "No task with this ID %s", taskID)
+	}
+	if task.Status != "progress" || task.Executor == "" {
+		return nil, newAPIError(codeInvalidStatus, "task %s is not claimed (status %s)", taskID, task.Status)
+	}
+	if task.Executor != executor {
+		return nil, newAPIError(codeExecutorConflict, "task %s is claimed by another executor", taskID)
+	}
+	return task, nil
+}
+
+func claimTask(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	var claimTaskReq ClaimTaskReq
+	reqBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		log.Warn(err)
+		return
+	}
+	json.Unmarshal(reqBody, &claimTaskReq)
+	if claimTaskReq.Executor == "" || claimTaskReq.Zone == "" {
+		err = newAPIError(codeInvalidRequest, "executor and zone are required")
+		writeError(w, http.StatusBadRequest, err)
+		log.Warn(err)
+		return
+	}
+
+	var resp []byte
+	err = engine.Update(func() error {
+		now := clock.Now()
+		task := nextDueAutoTask(claimTaskReq.Zone, now)
+		if task == nil {
+			return nil
+		}
+		if task.ActualStartDatetime == nil {
+			task.ActualStartDatetime = &now
+		}
+		task.Status = "progress"
+		task.Executor = claimTaskReq.Executor
+		task.LastHeartbeat = &now
+		var err error
+		resp, err = json.Marshal(inRequestLocation(r, task))
+		return err
+	})
+	if err != nil {
+		updateError(w, r, err)
+		return
+	}
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info(fmt.Sprintf("Executor %s claimed task in zone %s", claimTaskReq.Executor, claimTaskReq.Zone))
+}
+
+func heartbeatTask(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	var heartbeatReq HeartbeatReq
+	reqBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		log.Warn(err)
+		return
+	}
+	json.Unmarshal(reqBody, &heartbeatReq)
+	if heartbeatReq.Progress < 0 || heartbeatReq.Progress > 100 {
+		err = newAPIError(codeInvalidRequest, "progress should be from 0 to 100")
+		writeError(w, http.StatusBadRequest, err)
+		log.Warn(err)
+		return
+	}
+
+	taskID := mux.Vars(r)["uuid"]
+	var resp []byte
+	err = engine.Update(func() error {
+		task, err := claimedTask(taskID, heartbeatReq.Executor)
+		if err != nil {
+			return err
+		}
+		now := clock.Now()
+		task.LastHeartbeat = &now
+		task.Progress = heartbeatReq.Progress
+		resp, err = json.Marshal(inRequestLocation(r, task))
+		return err
+	})
+	if err != nil {
+		updateError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Debug("Heartbeat for task ", taskID)
+}
+
+func reportTask(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	var reportReq ReportReq
+	reqBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		log.Warn(err)
+		return
+	}
+	json.Unmarshal(reqBody, &reportReq)
+
+	taskID := mux.Vars(r)["uuid"]
+	var resp []byte
+	err = engine.Update(func() error {
+		task, err := claimedTask(taskID, reportReq.Executor)
+		if err != nil {
+			return err
+		}
+		if reportReq.Success {
+			task.Progress = 100
+			finishTask(task, "complete", clock.Now(), reportReq.Message)
+		} else {
+			finishTask(task, "failed", clock.Now(), reportReq.Message)
+		}
+		resp, err = json.Marshal(inRequestLocation(r, task))
+		return err
+	})
+	if err != nil {
+		updateError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextDueAutoTaskWaitsForDependencies(t *testing.T) {
+	testClock := setupState(t, "dev1", "dev2")
+	dependency := newTestTask("a", "auto", testStart, time.Hour, "dev1")
+	placeTestTask(dependency)
+	dependent := newTestTask("b", "auto", testStart.Add(time.Hour), time.Hour, "dev2")
+	dependent.Dependencies = []Dependency{{TaskID: dependency.ID}}
+	placeTestTask(dependent)
+
+	testClock.now = testStart.Add(time.Hour + time.Minute)
+	if task := nextDueAutoTask("dev2", testClock.Now()); task != nil {
+		t.Fatalf("claimable task %s while its dependency is %s", task.ID, dependency.Status)
+	}
+
+	finishTask(dependency, "complete", testClock.Now(), "")
+	if task := nextDueAutoTask("dev2", testClock.Now()); task == nil || task.ID != dependent.ID {
+		t.Fatalf("claimable task is %v after its dependency completed, want %s", task, dependent.ID)
+	}
+}
+
+func TestNextDueAutoTaskSkipsEndedSlots(t *testing.T) {
+	testClock := setupState(t, "dev1")
+	ended := newTestTask("a", "auto", testStart, time.Hour, "dev1")
+	placeTestTask(ended)
+	running := newTestTask("b", "auto", testStart.Add(time.Hour+10*time.Minute), time.Hour, "dev1")
+	placeTestTask(running)
+
+	testClock.now = testStart.Add(time.Hour)
+	if task := nextDueAutoTask("dev1", testClock.Now()); task != nil {
+		t.Fatalf("claimable task %s at the end of its slot", task.ID)
+	}
+	testClock.now = testStart.Add(time.Hour + 20*time.Minute)
+	if task := nextDueAutoTask("dev1", testClock.Now()); task == nil || task.ID != running.ID {
+		t.Fatalf("claimable task is %v, want %s whose slot hasn't ended", task, running.ID)
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// Freeze is a change freeze: only critical tasks can run in its zones (all zones if empty) from Start to End
+type Freeze struct {
+	ID     string
+	Name   string
+	Zones  []string `json:",omitempty"`
+	Start  time.Time
+	End    time.Time
+	Source string // config, api or ics
+	UID    string `json:",omitempty"` // event UID of imported freezes; importing it again replaces the freeze
+}
+
+// FreezeConfig is a freeze in the common config
+type FreezeConfig struct {
+	Name  string   `mapstructure:"name"`
+	Zones []string `mapstructure:"zones"`
+	Start string   `mapstructure:"start"`
+	End   string   `mapstructure:"end"`
+}
+
+// freezes added via API or imported; freezes from config are in config.Freezes
+var freezes = make(map[string]*Freeze)
+
+func (f Freeze) clone() Freeze {
+	f.Zones = append([]string{}, f.Zones...)
+	return f
+}
+
+func loadFreezes() error {
+	configFreezes := []*Freeze{}
+	for i, freezeConfig := range config.FreezesRaw {
+		start, err := parseDatetime(freezeConfig.Start, time.UTC)
+		if err != nil {
+			return fmt.Errorf("configuration error: freeze %s: %s", freezeConfig.Name, err.Error())
+		}
+		end, err := parseDatetime(freezeConfig.End, time.UTC)
+		if err != nil {
+			return fmt.Errorf("configuration error: freeze %s: %s", freezeConfig.Name, err.Error())
+		}
+		if !end.After(start) {
+			return fmt.Errorf("configuration error: freeze %s ends before it starts", freezeConfig.Name)
+		}
+		configFreezes = append(configFreezes, &Freeze{
+			ID:     fmt.Sprintf("config-%d", i+1),
+			Name:   freezeConfig.Name,
+			Zones:  freezeConfig.Zones,
+			Start:  start,
+			End:    end,
+			Source: "config",
+		})
+	}
+	config.Freezes = configFreezes
+	return nil
+}
+
+// allFreezes lists config and API freezes ordered by start
+func allFreezes() []*Freeze {
+	all := append([]*Freeze{}, config.Freezes...)
+	for _, freeze := range freezes {
+		all = append(all, freeze)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Start.Equal(all[j].Start) {
+			return all[i].ID < all[j].ID
+		}
+		return all[i].Start.Before(all[j].Start)
+	})
+	return all
+}
+
+func (f *Freeze) appliesTo(zone string) bool {
+	if len(f.Zones) == 0 {
+		return true
+	}
+	for _, freezeZone := range f.Zones {
+		if freezeZone == zone {
+			return true
+		}
+	}
+	return false
+}
+
+// frozenBy returns the first freeze of the zone overlapping start-end
+func frozenBy(zone string, start time.Time, end time.Time) *Freeze {
+	for _, freeze := range allFreezes() {
+		if freeze.appliesTo(zone) && overlap(start, end, freeze.Start, freeze.End) {
+			return freeze
+		}
+	}
+	return nil
+}
+
+func checkFreeze(task *Task, zone string, start time.Time, end time.Time) error {
+	if task.Critical {
+		return nil
+	}
+	if freeze := frozenBy(zone, start, end); freeze != nil {
+		return &APIError{Code: codeZoneFrozen, Message: fmt.Sprintf("zone %s is frozen (%s) %v-%v and task is not critical", zone, freeze.Name, freeze.Start, freeze.End), Zone: zone}
+	}
+	return nil
+}
+
+// moveOutOfFreezes moves waiting noncritical tasks overlapping freezes to the first free slot after their start
+// or cancels them if there is none before the deadline
+func moveOutOfFreezes() {
+	frozen := []string{}
+	for taskID, task := range tasks {
+		if task.Status != "wait" || task.Critical || !isScheduled(taskID) {
+			continue
+		}
+		for _, zone := range task.Zones {
+			if frozenBy(zone, task.StartDatetime, task.StartDatetime.Add(task.Duration)) != nil {
+				frozen = append(frozen, taskID)
+				break
+			}
+		}
+	}
+	for _, taskID := range topologicalOrder(frozen) {
+		task := tasks[taskID]
+		if task.Status != "wait" || !isScheduled(taskID) { // displaced by a task moved earlier
+			continue
+		}
+		if placeEarliest(task) {
+			log.Info(fmt.Sprintf("Moved task %s out of freeze to %v", taskID, task.StartDatetime))
+			continue
+		}
+		cancelTask(taskID)
+		task.Result = fmt.Sprintf("no free slot outside change freezes before deadline %v", task.Deadline)
+		log.Warn(fmt.Sprintf("Cancelled task %s: no free slot outside change freezes", taskID))
+	}
+}
+
+func freezeFromReq(freezeReq FreezeReq, loc *time.Location) (Freeze, error) {
+	start, err := parseDatetime(freezeReq.Start, loc)
+	if err != nil {
+		return Freeze{}, err
+	}
+	end, err := parseDatetime(freezeReq.End, loc)
+	if err != nil {
+		return Freeze{}, err
+	}
+	if !end.After(start) {
+		return Freeze{}, newAPIError(codeInvalidRequest, "freeze should end after it starts")
+	}
+	return Freeze{
+		ID:     uuid.New().String(),
+		Name:   freezeReq.Name,
+		Zones:  freezeReq.Zones,
+		Start:  start,
+		End:    end,
+		Source: "api",
+	}, nil
+}
+
+func listFreezes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	var resp []byte
+	var err error
+	engine.View(func() {
+		resp, err = json.Marshal(inRequestLocation(r, allFreezes()))
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		log.Error(err)
+		return
+	}
+	w.Write(resp)
+}
+
+// writeFreezeDryRun reports which tasks a freeze operation would move out of freezes or cancel
+func writeFreezeDryRun(w http.ResponseWriter, r *http.Request, apply func() error, changed *[]*Freeze) {
+	var resp []byte
+	writeDryRunResp(w, r, func() error {
+		if err := apply(); err != nil {
+			return err
+		}
+		var err error
+		resp, err = json.Marshal(inRequestLocation(r, *changed))
+		return err
+	}, func(dryRunResp *DryRunResp) {
+		dryRunResp.Freezes = resp
+	}, nil)
+}
+
+// addFreeze adds a freeze and moves conflicting tasks out of it
+func addFreeze(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	var freezeReq FreezeReq
+	reqBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		log.Warn(err)
+		return
+	}
+	json.Unmarshal(reqBody, &freezeReq)
+	freeze, err := freezeFromReq(freezeReq, requestLocation(r))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		log.Warn(err)
+		return
+	}
+	var resp []byte
+	if isDryRun(r) {
+		writeFreezeDryRun(w, r, func() error {
+			freezes[freeze.ID] = &freeze
+			moveOutOfFreezes()
+			return nil
+		}, &[]*Freeze{&freeze})
+		return
+	}
+	err = engine.Update(func() error {
+		freezes[freeze.ID] = &freeze
+		moveOutOfFreezes()
+		var err error
+		resp, err = json.Marshal(inRequestLocation(r, FreezeResp{Freezes: []*Freeze{&freeze}, Changes: engine.Changes()}))
+		return err
+	})
+	if err != nil {
+		updateError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	w.Write(resp)
+	log.Info("Added freeze ", freeze.ID)
+}
+
+// importFreezes adds a freeze for every event of the iCalendar body in zones from the query (all zones by default)
+func importFreezes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	reqBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		log.Warn(err)
+		return
+	}
+	events, err := parseICS(string(reqBody), requestLocation(r))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		log.Warn(err)
+		return
+	}
+	zones := []string{}
+	if zonesParam := r.URL.Query().Get("zones"); zonesParam != "" {
+		zones = strings.Split(zonesParam, ",")
+	}
+	imported := []*Freeze{}
+	for _, event := range events {
+		imported = append(imported, &Freeze{
+			ID:     uuid.New().String(),
+			Name:   event.Summary,
+			Zones:  zones,
+			Start:  event.Start.UTC(),
+			End:    event.End.UTC(),
+			Source: "ics",
+			UID:    event.UID,
+		})
+	}
+	apply := func() error {
+		for _, freeze := range imported {
+			for freezeID, existing := range freezes {
+				if freeze.UID != "" && existing.UID == freeze.UID {
+					delete(freezes, freezeID)
+				}
+			}
+			freezes[freeze.ID] = freeze
+		}
+		moveOutOfFreezes()
+		return nil
+	}
+	if isDryRun(r) {
+		writeFreezeDryRun(w, r, apply, &imported)
+		return
+	}
+	var resp []byte
+	err = engine.Update(func() error {
+		if err := apply(); err != nil {
+			return err
+		}
+		var err error
+		resp, err = json.Marshal(inRequestLocation(r, FreezeResp{Freezes: imported, Changes: engine.Changes()}))
+		return err
+	})
+	if err != nil {
+		updateError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	w.Write(resp)
+	log.Info(fmt.Sprintf("Imported %d freezes", len(imported)))
+}
+
+func deleteFreeze(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	freezeID := mux.Vars(r)["uuid"]
+	deleted := []*Freeze{}
+	apply := func() error {
+		freeze, ok := freezes[freezeID]
+		if !ok {
+			return newAPIError(codeFreezeNotFound, "No freeze with this ID %s (freezes from config can only be removed from config)", freezeID)
+		}
+		deleted = []*Freeze{freeze}
+		delete(freezes, freezeID)
+		return nil
+	}
+	if isDryRun(r) {
+		writeFreezeDryRun(w, r, apply, &deleted)
+		return
+	}
+	var resp []byte
+	err := engine.Update(func() error {
+		if err := apply(); err != nil {
+			return err
+		}
+		var err error
+		resp, err = json.Marshal(inRequestLocation(r, FreezeResp{Freezes: deleted, Changes: engine.Changes()}))
+		return err
+	})
+	if err != nil {
+		updateError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info("Deleted freeze ", freezeID)
+}
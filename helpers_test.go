@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock tests move by hand
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+var testStart = time.Date(2030, 1, 7, 0, 0, 0, 0, time.UTC)
+
+// setupState resets tasks, schedule and configs to zones open around the clock with 5m pauses
+// and sets the clock to testStart
+func setupState(tb testing.TB, zones ...string) *fakeClock {
+	tb.Helper()
+	testClock := &fakeClock{now: testStart}
+	clock = testClock
+	store = &memoryStore{}
+	config = Config{WhiteListRaw: make(map[string][]string), Pauses: make(map[string]time.Duration)}
+	for _, zone := range zones {
+		config.WhiteListRaw[zone] = []string{"00:00-23:59"}
+		config.Pauses[zone] = 5 * time.Minute
+	}
+	if err := loadWhiteList(); err != nil {
+		tb.Fatal(err)
+	}
+	if err := loadTimezones(); err != nil {
+		tb.Fatal(err)
+	}
+	durations = Durations{
+		DeadlineDuration:         30 * 24 * time.Hour,
+		PreferredManualStartMult: 5 * time.Minute,
+		PreferredAutoStartMult:   time.Minute,
+		HeartbeatTimeout:         5 * time.Minute,
+	}
+	tasks = make(map[string]*Task)
+	schedule = make(map[string]*zoneIndex)
+	recurringSeries = make(map[string]*Series)
+	freezes = make(map[string]*Freeze)
+	reloadReports = make(map[string]*ReloadReport)
+	preemptionLog = nil
+	optimizationPlan = nil
+	return testClock
+}
+
+// newTestTask is a waiting task with a week to its deadline
+func newTestTask(id string, taskType string, start time.Time, duration time.Duration, zones ...string) *Task {
+	priority := 2
+	if taskType == "manual" {
+		priority = 1
+	}
+	return &Task{
+		ID:                     id,
+		Name:                   id,
+		PreferredStartDatetime: start,
+		StartDatetime:          start,
+		Duration:               duration,
+		Deadline:               start.Add(7 * 24 * time.Hour),
+		Zones:                  zones,
+		Type:                   taskType,
+		Priority:               priority,
+		Status:                 "wait",
+		CreatedAt:              clock.Now(),
+	}
+}
+
+// placeTestTask adds the task at its start without checking for conflicts
+func placeTestTask(task *Task) {
+	tasks[task.ID] = task
+	for _, zone := range task.Zones {
+		insertTask(task.ID, zone)
+	}
+}
+
+// taskStarts is the start of every task by ID
+func taskStarts() map[string]time.Time {
+	starts := make(map[string]time.Time, len(tasks))
+	for taskID, task := range tasks {
+		starts[taskID] = task.StartDatetime
+	}
+	return starts
+}
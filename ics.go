@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// icsEvent is a VEVENT of an iCalendar (RFC 5545) file
+type icsEvent struct {
+	UID     string
+	Summary string
+	Start   time.Time
+	End     time.Time
+}
+
+var icsUnescaper = strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+// unfoldICS splits an iCalendar file into content lines joining lines folded with a leading space or tab
+func unfoldICS(data string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// parseICSTime parses DTSTART/DTEND values: dates, UTC times, times with TZID and floating times in loc
+func parseICSTime(params []string, value string, loc *time.Location) (time.Time, bool, error) {
+	for _, param := range params {
+		switch {
+		case param == "VALUE=DATE":
+			t, err := time.ParseInLocation("20060102", value, loc)
+			return t, true, err
+		case strings.HasPrefix(param, "TZID="):
+			tzLoc, err := time.LoadLocation(strings.Trim(strings.TrimPrefix(param, "TZID="), `"`))
+			if err != nil {
+				return time.Time{}, false, err
+			}
+			loc = tzLoc
+		}
+	}
+	if len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// parseICS reads events of an iCalendar file; all-day events without DTEND last one day
+func parseICS(data string, loc *time.Location) ([]icsEvent, error) {
+	events := []icsEvent{}
+	var event *icsEvent
+	allDay := false
+	for i, line := range unfoldICS(data) {
+		nameParams, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		params := strings.Split(nameParams, ";")
+		name := strings.ToUpper(params[0])
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			event = &icsEvent{}
+		case event == nil:
+		case name == "END" && value == "VEVENT":
+			if event.End.IsZero() && allDay {
+				event.End = event.Start.AddDate(0, 0, 1)
+			}
+			if event.Start.IsZero() || !event.End.After(event.Start) {
+				return nil, fmt.Errorf("event %q at line %d should have DTSTART before DTEND", event.Summary, i+1)
+			}
+			events = append(events, *event)
+			event = nil
+		case name == "UID":
+			event.UID = value
+		case name == "SUMMARY":
+			event.Summary = icsUnescaper.Replace(value)
+		case name == "DTSTART" || name == "DTEND":
+			t, date, err := parseICSTime(params[1:], value, loc)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s at line %d: %w", name, i+1, err)
+			}
+			if name == "DTSTART" {
+				event.Start, allDay = t, date
+			} else {
+				event.End = t
+			}
+		}
+	}
+	return events, nil
+}
+
+const icsProdID = "-//infratask_scheduler//schedule//EN"
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+// foldICS splits a content line into lines of at most 75 octets, the leading space of continuation lines included,
+// not cutting UTF-8 sequences
+func foldICS(line string) string {
+	folded := strings.Builder{}
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		folded.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = 74
+	}
+	folded.WriteString(line + "\r\n")
+	return folded.String()
+}
+
+func formatICSTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// icsTaskEvent renders the task as a VEVENT; the UID is stable so moves, extensions and cancellations update the event
+func icsTaskEvent(task *Task, now time.Time) string {
+	start, end := task.StartDatetime, task.StartDatetime.Add(task.Duration)
+	if task.ActualStartDatetime != nil {
+		start = *task.ActualStartDatetime
+	}
+	if task.ActualEndDatetime != nil {
+		end = *task.ActualEndDatetime
+	}
+	updated := task.UpdatedAt
+	if updated.IsZero() {
+		updated = now
+	}
+	status := "CONFIRMED"
+	switch task.Status {
+	case "cancel":
+		status = "CANCELLED"
+	case "paused":
+		status = "TENTATIVE"
+	}
+	description := fmt.Sprintf("Task %s\nType: %s, critical: %v\nStatus: %s", task.ID, task.Type, task.Critical, task.Status)
+	if task.Owner != "" {
+		description += "\nOwner: " + task.Owner
+	}
+	lines := []string{
+		"BEGIN:VEVENT",
+		"UID:" + task.ID + "@infratask_scheduler",
+		"DTSTAMP:" + formatICSTime(updated),
+		"LAST-MODIFIED:" + formatICSTime(updated),
+		fmt.Sprintf("SEQUENCE:%d", task.Revision),
+		"DTSTART:" + formatICSTime(start),
+		"DTEND:" + formatICSTime(end),
+		"SUMMARY:" + icsEscaper.Replace(task.Name),
+		"LOCATION:" + icsEscaper.Replace(strings.Join(task.Zones, ", ")),
+		"DESCRIPTION:" + icsEscaper.Replace(description),
+		"CATEGORIES:" + task.Type,
+		"STATUS:" + status,
+		"END:VEVENT",
+	}
+	event := strings.Builder{}
+	for _, line := range lines {
+		event.WriteString(foldICS(line))
+	}
+	return event.String()
+}
+
+// scheduleICS renders per-zone tasks of the zone and owner (any if empty), cancelled ones too, as an iCalendar feed
+func scheduleICS(zone string, owner string, now time.Time) string {
+	selected := []*Task{}
+	for _, task := range tasks {
+		if len(task.Children) > 0 || task.Status == "suggested" { // split and rollout tasks are shown by their per-zone tasks
+			continue
+		}
+		if owner != "" && task.Owner != owner {
+			continue
+		}
+		if zone != "" && !containsString(task.Zones, zone) {
+			continue
+		}
+		selected = append(selected, task)
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		if selected[i].StartDatetime.Equal(selected[j].StartDatetime) {
+			return selected[i].ID < selected[j].ID
+		}
+		return selected[i].StartDatetime.Before(selected[j].StartDatetime)
+	})
+	calendarName := "infratask schedule"
+	if zone != "" {
+		calendarName += " " + zone
+	}
+	if owner != "" {
+		calendarName += " (" + owner + ")"
+	}
+	calendar := strings.Builder{}
+	for _, line := range []string{"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:" + icsProdID, "CALSCALE:GREGORIAN", "METHOD:PUBLISH", "X-WR-CALNAME:" + icsEscaper.Replace(calendarName)} {
+		calendar.WriteString(foldICS(line))
+	}
+	for _, task := range selected {
+		calendar.WriteString(icsTaskEvent(task, now))
+	}
+	calendar.WriteString(foldICS("END:VCALENDAR"))
+	return calendar.String()
+}
+
+// showScheduleICS is the iCalendar feed of the whole schedule or of ?zone= and/or ?owner=
+func showScheduleICS(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var calendar string
+	engine.View(func() {
+		calendar = scheduleICS(query.Get("zone"), query.Get("owner"), clock.Now())
+	})
+	w.Header().Add("Content-Type", "text/calendar; charset=utf-8")
+	w.Write([]byte(calendar))
+}
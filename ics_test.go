@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestICSFoldsLongMultiByteLines(t *testing.T) {
+	setupState(t, "dev1")
+	task := newTestTask("a", "manual", testStart, time.Hour, "dev1")
+	task.Name = strings.Repeat("Обновление ядра — 🛠 kernel, ", 8)
+	event := icsTaskEvent(task, testStart)
+
+	for _, line := range strings.Split(strings.TrimSuffix(event, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Fatalf("line of %d octets: %q", len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Fatalf("line cuts a UTF-8 sequence: %q", line)
+		}
+	}
+	events, err := parseICS("BEGIN:VCALENDAR\r\n"+event+"END:VCALENDAR\r\n", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Summary != task.Name {
+		t.Fatalf("unfolded events %+v, want the summary %q", events, task.Name)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"hash/fnv"
+	"time"
+)
+
+// span is the slot a task had when it was inserted into a zone index
+type span struct {
+	TaskID string
+	Start  time.Time
+	End    time.Time
+}
+
+func (s span) before(other span) bool {
+	if s.Start.Equal(other.Start) {
+		return s.TaskID < other.TaskID
+	}
+	return s.Start.Before(other.Start)
+}
+
+// intervalNode is a node of a treap ordered by start (then task ID) and heap-ordered by a hash of the task ID;
+// maxEnd is the latest end in its subtree
+type intervalNode struct {
+	span
+	priority    uint32
+	maxEnd      time.Time
+	left, right *intervalNode
+}
+
+func (n *intervalNode) update() {
+	n.maxEnd = n.End
+	if n.left != nil && n.left.maxEnd.After(n.maxEnd) {
+		n.maxEnd = n.left.maxEnd
+	}
+	if n.right != nil && n.right.maxEnd.After(n.maxEnd) {
+		n.maxEnd = n.right.maxEnd
+	}
+}
+
+func (n *intervalNode) clone() *intervalNode {
+	if n == nil {
+		return nil
+	}
+	cloned := *n
+	cloned.left, cloned.right = n.left.clone(), n.right.clone()
+	return &cloned
+}
+
+// spanPriority derives the treap priority from the task ID so the tree shape doesn't depend on chance
+func spanPriority(taskID string) uint32 {
+	hash := fnv.New32a()
+	hash.Write([]byte(taskID))
+	return hash.Sum32()
+}
+
+// splitNodes splits the tree into spans before s and the rest
+func splitNodes(n *intervalNode, s span) (*intervalNode, *intervalNode) {
+	if n == nil {
+		return nil, nil
+	}
+	if n.span.before(s) {
+		left, right := splitNodes(n.right, s)
+		n.right = left
+		n.update()
+		return n, right
+	}
+	left, right := splitNodes(n.left, s)
+	n.left = right
+	n.update()
+	return left, n
+}
+
+// mergeNodes joins trees where every span of left is before every span of right
+func mergeNodes(left *intervalNode, right *intervalNode) *intervalNode {
+	switch {
+	case left == nil:
+		return right
+	case right == nil:
+		return left
+	case left.priority > right.priority:
+		left.right = mergeNodes(left.right, right)
+		left.update()
+		return left
+	}
+	right.left = mergeNodes(left, right.left)
+	right.update()
+	return right
+}
+
+func removeNode(n *intervalNode, s span) *intervalNode {
+	if n == nil {
+		return nil
+	}
+	switch {
+	case n.span == s:
+		return mergeNodes(n.left, n.right)
+	case s.before(n.span):
+		n.left = removeNode(n.left, s)
+	default:
+		n.right = removeNode(n.right, s)
+	}
+	n.update()
+	return n
+}
+
+// zoneIndex is an interval tree of the tasks scheduled in a zone; it replaces the ordered list of task IDs,
+// so overlap queries skip subtrees ending before the queried interval instead of scanning every task
+type zoneIndex struct {
+	root  *intervalNode
+	spans map[string]span // by task ID, to remove tasks whose slot has changed since they were inserted
+}
+
+func newZoneIndex() *zoneIndex {
+	return &zoneIndex{spans: make(map[string]span)}
+}
+
+func (z *zoneIndex) clone() *zoneIndex {
+	cloned := &zoneIndex{root: z.root.clone(), spans: make(map[string]span, len(z.spans))}
+	for taskID, s := range z.spans {
+		cloned.spans[taskID] = s
+	}
+	return cloned
+}
+
+func (z *zoneIndex) len() int {
+	if z == nil {
+		return 0
+	}
+	return len(z.spans)
+}
+
+func (z *zoneIndex) contains(taskID string) bool {
+	if z == nil {
+		return false
+	}
+	_, ok := z.spans[taskID]
+	return ok
+}
+
+func (z *zoneIndex) insert(taskID string, start time.Time, end time.Time) {
+	z.remove(taskID)
+	s := span{TaskID: taskID, Start: start, End: end}
+	node := &intervalNode{span: s, priority: spanPriority(taskID), maxEnd: end}
+	left, right := splitNodes(z.root, s)
+	z.root = mergeNodes(mergeNodes(left, node), right)
+	z.spans[taskID] = s
+}
+
+func (z *zoneIndex) remove(taskID string) {
+	s, ok := z.spans[taskID]
+	if !ok {
+		return
+	}
+	z.root = removeNode(z.root, s)
+	delete(z.spans, taskID)
+}
+
+// overlapping returns spans ordered by start that overlap start-end
+func (z *zoneIndex) overlapping(start time.Time, end time.Time) []span {
+	found := []span{}
+	if z == nil {
+		return found
+	}
+	var visit func(n *intervalNode)
+	visit = func(n *intervalNode) {
+		if n == nil || !n.maxEnd.After(start) {
+			return
+		}
+		visit(n.left)
+		if !n.Start.Before(end) {
+			return
+		}
+		if n.End.After(start) {
+			found = append(found, n.span)
+		}
+		visit(n.right)
+	}
+	visit(z.root)
+	return found
+}
+
+// endingAfter returns spans ordered by start that end after t
+func (z *zoneIndex) endingAfter(t time.Time) []span {
+	return z.overlapping(t, time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC))
+}
+
+// ordered returns all spans ordered by start
+func (z *zoneIndex) ordered() []span {
+	return z.endingAfter(time.Time{})
+}
+
+// taskIDs returns IDs of the scheduled tasks ordered by start
+func (z *zoneIndex) taskIDs() []string {
+	taskIDs := []string{}
+	for _, s := range z.ordered() {
+		taskIDs = append(taskIDs, s.TaskID)
+	}
+	return taskIDs
+}
+
+// earliestFit is the earliest start from from on at which duration fits between blocking spans followed by pause
+func (z *zoneIndex) earliestFit(from time.Time, duration time.Duration, pause time.Duration, blocks func(taskID string) bool) time.Time {
+	start := from
+	for {
+		moved := false
+		for _, s := range z.overlapping(start.Add(-pause), start.Add(duration)) {
+			if blocks(s.TaskID) && s.End.Add(pause).After(start) {
+				start = s.End.Add(pause)
+				moved = true
+			}
+		}
+		if !moved {
+			return start
+		}
+	}
+}
+
+// scheduleTaskIDs is the schedule as ordered task IDs by zone, as it is persisted
+func scheduleTaskIDs() map[string][]string {
+	taskIDs := make(map[string][]string, len(schedule))
+	for zone, zoneSchedule := range schedule {
+		taskIDs[zone] = zoneSchedule.taskIDs()
+	}
+	return taskIDs
+}
+
+// indexSchedule builds zone indexes from persisted task IDs by zone with the slots of the tasks
+func indexSchedule(taskIDs map[string][]string) map[string]*zoneIndex {
+	indexed := make(map[string]*zoneIndex, len(taskIDs))
+	for zone, zoneTaskIDs := range taskIDs {
+		indexed[zone] = newZoneIndex()
+		for _, taskID := range zoneTaskIDs {
+			if task, ok := tasks[taskID]; ok {
+				indexed[zone].insert(taskID, task.StartDatetime, task.StartDatetime.Add(task.Duration))
+			}
+		}
+	}
+	return indexed
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fillZones places n 10m auto tasks round-robin over the zones, one every 20m in each zone
+func fillZones(n int, zones ...string) {
+	for i := 0; i < n; i++ {
+		start := testStart.Add(time.Duration(i/len(zones)) * 20 * time.Minute)
+		placeTestTask(newTestTask(fmt.Sprintf("t%06d", i), "auto", start, 10*time.Minute, zones[i%len(zones)]))
+	}
+}
+
+func benchmarkPlaceEarliest(b *testing.B, n int) {
+	zones := []string{"dev1", "dev2", "dev3", "dev4"}
+	setupState(b, zones...)
+	fillZones(n, zones...)
+	// the gaps between tasks are too short, so the task is tried at many points before it fits
+	start := testStart.Add(time.Duration(n/len(zones)/2) * 20 * time.Minute)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		task := newTestTask(fmt.Sprintf("new%06d", i), "auto", start, 15*time.Minute, "dev2", "dev3")
+		tasks[task.ID] = task
+		if !placeEarliest(task) {
+			b.Fatal("task not placed")
+		}
+		b.StopTimer()
+		cancelTask(task.ID)
+		delete(tasks, task.ID)
+		b.StartTimer()
+	}
+}
+
+func BenchmarkPlaceEarliest1000(b *testing.B) { benchmarkPlaceEarliest(b, 1000) }
+func BenchmarkPlaceEarliest4000(b *testing.B) { benchmarkPlaceEarliest(b, 4000) }
+
+func benchmarkScheduleTask(b *testing.B, n int) {
+	zones := []string{"dev1", "dev2", "dev3", "dev4"}
+	setupState(b, zones...)
+	fillZones(n, zones...)
+	// the manual task displaces an auto task, which is re-placed in a nested attempt
+	start := testStart.Add(time.Duration(n/len(zones)/2) * 20 * time.Minute)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		before := snapshotState()
+		task := newTestTask(fmt.Sprintf("new%06d", i), "manual", start, 10*time.Minute, "dev1")
+		tasks[task.ID] = task
+		b.StartTimer()
+		if err := scheduleTask(task, "wait"); err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		restoreState(before)
+		b.StartTimer()
+	}
+}
+
+func BenchmarkScheduleTask1000(b *testing.B) { benchmarkScheduleTask(b, 1000) }
+func BenchmarkScheduleTask4000(b *testing.B) { benchmarkScheduleTask(b, 4000) }
+
+// filledZoneIndex indexes n 10m tasks, one every 20m, and returns the index with its spans ordered by start
+func filledZoneIndex(n int) (*zoneIndex, []span) {
+	index := newZoneIndex()
+	for i := 0; i < n; i++ {
+		start := testStart.Add(time.Duration(i) * 20 * time.Minute)
+		index.insert(fmt.Sprintf("t%06d", i), start, start.Add(10*time.Minute))
+	}
+	return index, index.ordered()
+}
+
+// scanOverlapping is the linear scan over ordered spans the zone index replaced, kept as a baseline
+func scanOverlapping(spans []span, start time.Time, end time.Time) []span {
+	found := []span{}
+	for _, s := range spans {
+		if s.Start.Before(end) && s.End.After(start) {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+func benchmarkOverlapping(b *testing.B, n int, scan bool) {
+	index, spans := filledZoneIndex(n)
+	start := testStart.Add(time.Duration(n/2) * 20 * time.Minute)
+	end := start.Add(time.Hour)
+	if got, want := len(index.overlapping(start, end)), len(scanOverlapping(spans, start, end)); got != want {
+		b.Fatalf("index found %d spans, scan found %d", got, want)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if scan {
+			scanOverlapping(spans, start, end)
+		} else {
+			index.overlapping(start, end)
+		}
+	}
+}
+
+func BenchmarkOverlapping1000(b *testing.B)      { benchmarkOverlapping(b, 1000, false) }
+func BenchmarkOverlapping10000(b *testing.B)     { benchmarkOverlapping(b, 10000, false) }
+func BenchmarkScanOverlapping1000(b *testing.B)  { benchmarkOverlapping(b, 1000, true) }
+func BenchmarkScanOverlapping10000(b *testing.B) { benchmarkOverlapping(b, 10000, true) }
+
+func benchmarkEarliestFit(b *testing.B, n int, scan bool) {
+	index, spans := filledZoneIndex(n)
+	// the 10m gaps are too short for 15m with a 1m pause, so the search moves past every task after from
+	from := testStart.Add(time.Duration(n/2) * 20 * time.Minute)
+	blocks := func(string) bool { return true }
+	want := index.earliestFit(from, 15*time.Minute, time.Minute, blocks)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var got time.Time
+		if scan {
+			got = from
+			for moved := true; moved; {
+				moved = false
+				for _, s := range scanOverlapping(spans, got.Add(-time.Minute), got.Add(15*time.Minute)) {
+					if s.End.Add(time.Minute).After(got) {
+						got = s.End.Add(time.Minute)
+						moved = true
+					}
+				}
+			}
+		} else {
+			got = index.earliestFit(from, 15*time.Minute, time.Minute, blocks)
+		}
+		if !got.Equal(want) {
+			b.Fatalf("earliest fit at %v, want %v", got, want)
+		}
+	}
+}
+
+func BenchmarkEarliestFit1000(b *testing.B)     { benchmarkEarliestFit(b, 1000, false) }
+func BenchmarkEarliestFit4000(b *testing.B)     { benchmarkEarliestFit(b, 4000, false) }
+func BenchmarkScanEarliestFit1000(b *testing.B) { benchmarkEarliestFit(b, 1000, true) }
+func BenchmarkScanEarliestFit4000(b *testing.B) { benchmarkEarliestFit(b, 4000, true) }
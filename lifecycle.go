@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Clock is the source of current time for validation and task lifecycle; replaced in tests
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+var clock Clock = realClock{}
+
+// advanceLifecycle moves tasks wait -> progress at their start (once their dependencies complete) and progress -> complete at their end,
+// freeing the schedule slot of finished tasks; auto tasks are finished by their executor or failed when it goes silent
+func advanceLifecycle(now time.Time) {
+	// in start order, so a failed rollout stage pauses later stages before they could start
+	taskIDs := []string{}
+	for taskID := range tasks {
+		taskIDs = append(taskIDs, taskID)
+	}
+	sort.Slice(taskIDs, func(i, j int) bool {
+		a, b := tasks[taskIDs[i]], tasks[taskIDs[j]]
+		if !a.StartDatetime.Equal(b.StartDatetime) {
+			return a.StartDatetime.Before(b.StartDatetime)
+		}
+		return a.ID < b.ID
+	})
+	for _, taskID := range taskIDs {
+		task := tasks[taskID]
+		if task.Status == "wait" && !now.Before(task.StartDatetime) {
+			if pending := pendingDependency(task); pending != "" { // waits for its dependencies to complete
+				if !now.Before(task.StartDatetime.Add(task.Duration)) {
+					finishTask(task, "failed", now, fmt.Sprintf("dependency %s did not complete before the end of the slot", pending))
+				}
+				continue
+			}
+			started := now
+			task.Status = "progress"
+			task.ActualStartDatetime = &started
+			log.Info("Started task ", taskID)
+		}
+		if task.Status != "progress" {
+			continue
+		}
+		ended := !now.Before(task.StartDatetime.Add(task.Duration))
+		if task.Type == "auto" {
+			if task.Executor == "" && ended {
+				finishTask(task, "failed", now, "not claimed by any executor before the end of its slot")
+			}
+			if task.Executor != "" && durations.HeartbeatTimeout > 0 && now.Sub(*task.LastHeartbeat) > durations.HeartbeatTimeout {
+				finishTask(task, "failed", now, fmt.Sprintf("no heartbeat from executor %s for %v", task.Executor, durations.HeartbeatTimeout))
+			}
+			continue
+		}
+		if ended {
+			finishTask(task, "complete", now, "")
+		}
+	}
+}
+
+// finishTask sets final status (complete or failed) and frees the schedule slot
+func finishTask(task *Task, status string, now time.Time, result string) {
+	ended := now
+	unscheduleTask(task.ID)
+	task.Status = status
+	task.ActualEndDatetime = &ended
+	task.Result = result
+	if status == "failed" {
+		log.Warn(fmt.Sprintf("Task %s failed: %s", task.ID, result))
+		pauseRollout(task)
+		return
+	}
+	log.Info("Completed task ", task.ID)
+}
+
+func runLifecycle(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := engine.Update(func() error {
+				now := clock.Now()
+				advanceLifecycle(now)
+				expandAllSeries(now)
+				return nil
+			})
+			if err != nil {
+				log.Error(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLifecycleManualTask(t *testing.T) {
+	testClock := setupState(t, "dev1")
+	task := newTestTask("a", "manual", testStart.Add(time.Hour), time.Hour, "dev1")
+	placeTestTask(task)
+
+	advanceLifecycle(testClock.Now())
+	if task.Status != "wait" {
+		t.Fatalf("task before its start is %s, want wait", task.Status)
+	}
+
+	testClock.now = testStart.Add(time.Hour)
+	advanceLifecycle(testClock.Now())
+	if task.Status != "progress" || task.ActualStartDatetime == nil || !task.ActualStartDatetime.Equal(testClock.now) {
+		t.Fatalf("task at its start is %s started at %v, want progress started at %v", task.Status, task.ActualStartDatetime, testClock.now)
+	}
+
+	testClock.now = testStart.Add(2*time.Hour + time.Minute)
+	advanceLifecycle(testClock.Now())
+	if task.Status != "complete" || task.ActualEndDatetime == nil || !task.ActualEndDatetime.Equal(testClock.now) {
+		t.Fatalf("task after its end is %s ended at %v, want complete ended at %v", task.Status, task.ActualEndDatetime, testClock.now)
+	}
+	if schedule["dev1"].contains(task.ID) {
+		t.Fatal("completed task still holds its slot")
+	}
+}
+
+func TestLifecycleWaitsForDependencies(t *testing.T) {
+	testClock := setupState(t, "dev1", "dev2")
+	dependency := newTestTask("a", "auto", testStart, time.Hour, "dev1")
+	dependency.Status = "progress"
+	dependency.Executor = "runner-1"
+	heartbeat := testStart
+	dependency.LastHeartbeat = &heartbeat
+	placeTestTask(dependency)
+	dependent := newTestTask("b", "manual", testStart.Add(time.Hour), time.Hour, "dev2")
+	dependent.Dependencies = []Dependency{{TaskID: dependency.ID}}
+	placeTestTask(dependent)
+
+	// the auto task runs over its slot and keeps sending heartbeats
+	testClock.now = testStart.Add(time.Hour + time.Minute)
+	heartbeat = testClock.now
+	advanceLifecycle(testClock.Now())
+	if dependency.Status != "progress" {
+		t.Fatalf("dependency with a recent heartbeat is %s, want progress", dependency.Status)
+	}
+	if dependent.Status != "wait" {
+		t.Fatalf("dependent of a running task is %s, want wait", dependent.Status)
+	}
+
+	finishTask(dependency, "complete", testClock.Now(), "done")
+	testClock.now = testStart.Add(time.Hour + 2*time.Minute)
+	advanceLifecycle(testClock.Now())
+	if dependent.Status != "progress" {
+		t.Fatalf("dependent of a completed task is %s, want progress", dependent.Status)
+	}
+}
+
+func TestLifecycleFailsDependentAtSlotEnd(t *testing.T) {
+	testClock := setupState(t, "dev1", "dev2")
+	dependency := newTestTask("a", "manual", testStart.Add(3*time.Hour), time.Hour, "dev1")
+	placeTestTask(dependency)
+	dependent := newTestTask("b", "manual", testStart.Add(time.Hour), time.Hour, "dev2")
+	dependent.Dependencies = []Dependency{{TaskID: dependency.ID}}
+	placeTestTask(dependent)
+
+	testClock.now = testStart.Add(2 * time.Hour)
+	advanceLifecycle(testClock.Now())
+	if dependent.Status != "failed" || !strings.Contains(dependent.Result, dependency.ID) {
+		t.Fatalf("dependent at the end of its slot is %s (%q), want failed naming its dependency", dependent.Status, dependent.Result)
+	}
+	if schedule["dev2"].contains(dependent.ID) {
+		t.Fatal("failed task still holds its slot")
+	}
+}
+
+func TestLifecycleHeartbeatTimeout(t *testing.T) {
+	testClock := setupState(t, "dev1")
+	task := newTestTask("a", "auto", testStart, 2*time.Hour, "dev1")
+	task.Status = "progress"
+	task.Executor = "runner-1"
+	heartbeat := testStart
+	task.LastHeartbeat = &heartbeat
+	placeTestTask(task)
+
+	testClock.now = testStart.Add(durations.HeartbeatTimeout)
+	advanceLifecycle(testClock.Now())
+	if task.Status != "progress" {
+		t.Fatalf("task within heartbeat timeout is %s, want progress", task.Status)
+	}
+
+	testClock.now = testStart.Add(durations.HeartbeatTimeout + time.Minute)
+	advanceLifecycle(testClock.Now())
+	if task.Status != "failed" || !strings.Contains(task.Result, "no heartbeat") {
+		t.Fatalf("task past heartbeat timeout is %s (%q), want failed for missing heartbeat", task.Status, task.Result)
+	}
+	if schedule["dev1"].contains(task.ID) {
+		t.Fatal("failed task still holds its slot")
+	}
+}
+
+func TestLifecycleFailsUnclaimedAutoTask(t *testing.T) {
+	testClock := setupState(t, "dev1")
+	task := newTestTask("a", "auto", testStart, time.Hour, "dev1")
+	placeTestTask(task)
+
+	advanceLifecycle(testClock.Now())
+	if task.Status != "progress" {
+		t.Fatalf("auto task at its start is %s, want progress", task.Status)
+	}
+	testClock.now = testStart.Add(time.Hour)
+	advanceLifecycle(testClock.Now())
+	if task.Status != "failed" {
+		t.Fatalf("unclaimed auto task at the end of its slot is %s, want failed", task.Status)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+// statusRank orders child statuses for the aggregate status of a split or rollout task: the first found wins
+var statusRank = []string{"progress", "wait", "paused", "failed", "complete", "cancel"}
+
+// aggregateStatus is the status of a split or rollout task derived from its per-zone tasks
+func aggregateStatus(task *Task) string {
+	found := make(map[string]bool)
+	for _, childID := range task.Children {
+		if child, ok := tasks[childID]; ok {
+			found[child.Status] = true
+		}
+	}
+	for _, status := range statusRank {
+		if found[status] {
+			return status
+		}
+	}
+	return task.Status
+}
+
+// childPlacements lists the per-zone slots of a split or rollout task
+func childPlacements(task *Task) []Placement {
+	placements := []Placement{}
+	for _, childID := range task.Children {
+		child, ok := tasks[childID]
+		if !ok {
+			continue
+		}
+		placements = append(placements, Placement{
+			TaskID:        child.ID,
+			Zones:         child.Zones,
+			StartDatetime: child.StartDatetime,
+			EndDatetime:   child.StartDatetime.Add(child.Duration),
+			Status:        child.Status,
+		})
+	}
+	return placements
+}
+
+func newTaskDetailResp(task *Task) TaskDetailResp {
+	resp := TaskDetailResp{Task: task}
+	if len(task.Children) > 0 {
+		resp.AggregateStatus = aggregateStatus(task)
+		resp.Placements = childPlacements(task)
+	}
+	return resp
+}
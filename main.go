@@ -10,7 +10,8 @@ import (
 	"os/signal"
 	"time"
 	"encoding/json"
-	"strings"
+	"errors"
+	"strconv"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/gorilla/mux"
@@ -27,16 +28,27 @@ type Durations struct {
 	DeadlineDuration time.Duration `mapstructure:"deadlineDuration"`
 	PreferredManualStartMult time.Duration `mapstructure:"preferredManualStartMult"`
 	PreferredAutoStartMult time.Duration `mapstructure:"preferredAutoStartMult"`
+	HeartbeatTimeout time.Duration `mapstructure:"heartbeatTimeout"`
+	RolloutSoak time.Duration `mapstructure:"rolloutSoak"`
 }
 
 var durations Durations
 
 type Config struct {
 	WhiteListRaw	map[string][]string	`mapstructure:"whiteList"`
-	WhiteList 		map[string][]timeSpan `mapstructure:"-"`
+	WhiteList 		map[string][]whiteListEntry `mapstructure:"-"`
+	TimezonesRaw	map[string]string `mapstructure:"timezones"`
+	Locations		map[string]*time.Location `mapstructure:"-"`
 	BlackList 		[]string `mapstructure:"blackList"`
+	FreezesRaw		[]FreezeConfig `mapstructure:"freezes"`
+	Freezes			[]*Freeze `mapstructure:"-"`
 	AvailableZones 	int `mapstructure:"availableZones"`
 	Pauses 			map[string]time.Duration `mapstructure:"pauses"`
+	ZoneGroups		map[string][]string `mapstructure:"zoneGroups"`
+	Optimizer		OptimizerConfig `mapstructure:"optimizer"`
+	Placement		map[string]string `mapstructure:"placement"` // placement strategies by zone, "default" for the rest
+	Webhooks		[]string `mapstructure:"webhooks"` // URLs reload reports are posted to
+	MaxSeriesOccurrences	int `mapstructure:"maxSeriesOccurrences"` // most occurrences a series may expand to over the deadline horizon
 }
 
 type timeSpan struct {
@@ -47,113 +59,97 @@ type timeSpan struct {
 var config Config
 
 func loadWhiteList() error {
-	whiteList := make(map[string][]timeSpan)
+	whiteList := make(map[string][]whiteListEntry)
 	for key, zoneSpans := range config.WhiteListRaw {
-		var timeSpans []timeSpan
-		for _, timeSpanString := range zoneSpans {
-			timeSpanSlice := strings.Split(timeSpanString, "-")
-			start, err := time.Parse("15:04", timeSpanSlice[0])
+		var entries []whiteListEntry
+		for _, entryString := range zoneSpans {
+			entry, err := parseWhiteListEntry(entryString)
 			if err != nil {
 				return fmt.Errorf("configuration error:%s", err.Error())
 			}
-			end, err := time.Parse("15:04", timeSpanSlice[1])
-			if err != nil {
-				return fmt.Errorf("configuration error:%s", err.Error())
-			}
-			if start.After(end) {
-				end = end.Add(time.Hour * 24)
-			}
-			timeSpans = append(timeSpans, timeSpan{
-				Start: start,
-				End: end,
-			})
+			entries = append(entries, entry)
 		}
-		whiteList[key] = timeSpans
+		whiteList[key] = entries
 	}
 	config.WhiteList = whiteList
 	return nil
 }
 
-func addTask(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "application/json")
-	var addTaskReq AddTaskReq
-	reqBody, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		log.Warn(err)
-		return
+// taskFromReq converts and validates a task request; the task is not scheduled
+func taskFromReq(addTaskReq AddTaskReq, loc *time.Location) (Task, error) {
+	if len(addTaskReq.Zones) == 0 {
+		return Task{}, newAPIError(codeInvalidRequest, "task should have at least one zone")
 	}
-	json.Unmarshal(reqBody, &addTaskReq)
 
 	// time conversion and validation
-	startDatetime, err := time.Parse("02/01/2006 15:04", addTaskReq.StartDatetime)
+	startDatetime, err := parseDatetime(addTaskReq.StartDatetime, loc)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		log.Warn(err)
-		return
+		return Task{}, err
 	}
+	startDatetime = roundStart(addTaskReq.Type, startDatetime)
 	duration, err := time.ParseDuration(addTaskReq.Duration)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		log.Warn(err)
-		return
+		return Task{}, err
 	}
-	if startDatetime.Before(time.Now()) || startDatetime.Add(duration).Before(time.Now()) {
-		err = fmt.Errorf("can't set tasks in the past")
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		log.Warn(err)
-		return
+	if startDatetime.Before(clock.Now()) || startDatetime.Add(duration).Before(clock.Now()) {
+		return Task{}, newAPIError(codePastStart, "can't set tasks in the past")
 	}
-	deadline, err := time.Parse("02/01/2006 15:04", addTaskReq.Deadline)
+	deadline, err := parseDatetime(addTaskReq.Deadline, loc)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		log.Warn(err)
-		return
+		return Task{}, err
 	}
 	if deadline.Before(startDatetime) || deadline.Before(startDatetime.Add((duration))) {
-		err = fmt.Errorf("can't set deadline earlier than task ends %v", deadline)
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		log.Warn(err)
-		return
+		return Task{}, newAPIError(codeDeadlineBeforeEnd, "can't set deadline earlier than task ends %v", deadline)
 	}
-	if time.Now().Add(durations.DeadlineDuration).Before(deadline) {
-		err = fmt.Errorf("can't set deadline longer than %v", durations.DeadlineDuration)
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		log.Warn(err)
-		return
+	if clock.Now().Add(durations.DeadlineDuration).Before(deadline) {
+		return Task{}, newAPIError(codeDeadlineTooFar, "can't set deadline longer than %v", durations.DeadlineDuration)
 	}
 	if addTaskReq.Type != "auto" && addTaskReq.Type != "manual" {
-		err = fmt.Errorf("unknown type of task")
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		log.Warn(err)
-		return
+		return Task{}, newAPIError(codeInvalidRequest, "unknown type of task")
 	}
 	if addTaskReq.Type == "auto" && addTaskReq.Critical {
-		err = fmt.Errorf("auto tasks can't be critical")
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		log.Warn(err)
-		return
+		return Task{}, newAPIError(codeInvalidRequest, "auto tasks can't be critical")
 	}
 	if addTaskReq.Type == "auto" && addTaskReq.CompressionPerc > 100 {
-		err = fmt.Errorf("compression precentage for auto tasks can't be more than 100")
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		log.Warn(err)
-		return
+		return Task{}, newAPIError(codeInvalidRequest, "compression precentage for auto tasks can't be more than 100")
+	}
+	err = validateDuration(addTaskReq.Type, addTaskReq.Critical, duration)
+	if err != nil {
+		return Task{}, err
+	}
+	err = validatePlacement(addTaskReq.Placement)
+	if err != nil {
+		return Task{}, err
+	}
+
+	dependencies, err := dependenciesFromReq(addTaskReq.Dependencies)
+	if err != nil {
+		return Task{}, err
+	}
+	soak := time.Duration(0)
+	if addTaskReq.Rollout {
+		soak = durations.RolloutSoak
+		if addTaskReq.Soak != "" {
+			soak, err = time.ParseDuration(addTaskReq.Soak)
+			if err != nil {
+				return Task{}, err
+			}
+		}
+		if soak < 0 {
+			return Task{}, newAPIError(codeInvalidRequest, "soak can't be negative")
+		}
 	}
 
 	prefStartDatetime := startDatetime
 	if addTaskReq.PreferredStartDatetime != "" {
-		prefStartDatetime, err = time.Parse("02/01/2006 15:04", addTaskReq.PreferredStartDatetime)
+		prefStartDatetime, err = parseDatetime(addTaskReq.PreferredStartDatetime, loc)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			log.Warn(err)
-			return
+			return Task{}, err
 		}
 	}
 
-	taskID := uuid.New().String()
 	task := Task{
-		ID: taskID,
+		ID: uuid.New().String(),
 		Name: addTaskReq.Name,
 		PreferredStartDatetime: prefStartDatetime,
 		StartDatetime: startDatetime,
@@ -165,70 +161,200 @@ func addTask(w http.ResponseWriter, r *http.Request) {
 		CompressionPerc: addTaskReq.CompressionPerc,
 		Priority: priorityRule(addTaskReq.Type, addTaskReq.Critical),
 		Status: "wait",
+		Dependencies: dependencies,
+		Soak: soak,
+		Owner: addTaskReq.Owner,
+		Labels: addTaskReq.Labels,
+		Placement: addTaskReq.Placement,
+		CreatedAt: clock.Now(),
 	}
-	tasks[task.ID] = &task
-	err = scheduleTask(&task, "wait")
+	return task, nil
+}
+
+func addTask(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	var addTaskReq AddTaskReq
+	reqBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		log.Warn(err)
+		return
+	}
+	json.Unmarshal(reqBody, &addTaskReq)
+
+	task, err := taskFromReq(addTaskReq, requestLocation(r))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		log.Warn(err)
+		return
+	}
+	var resp []byte
+	apply := func() error {
+		tasks[task.ID] = &task
+		if addTaskReq.Rollout {
+			err := scheduleRollout(&task)
+			if err != nil {
+				return err
+			}
+			resp, err = json.Marshal(inRequestLocation(r, newTaskResp(&task)))
+			return err
+		}
+		err := scheduleTask(&task, "wait")
+		if err != nil {
+			delete(tasks, task.ID)
+			return withSuggestions(err, task)
+		}
+		resp, err = json.Marshal(inRequestLocation(r, newTaskResp(&task)))
+		return err
+	}
+	if isDryRun(r) {
+		writeDryRun(w, r, apply, &resp, task.ID)
+		return
+	}
+	err = engine.Update(apply)
 	if err != nil {
-		delete(tasks, task.ID)
-		suggestion := suggestTimeString(task)
-		suggestion = err.Error() + "\n" + suggestion
-		http.Error(w, suggestion, http.StatusBadRequest)
-		log.Warn(suggestion)
+		updateError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusCreated)
 
-	json.NewEncoder(w).Encode(task)
+	w.Write(resp)
 	log.Info("Added task ", task.ID)
 }
 
+// listTasks returns the map of all tasks or, with query parameters, the page of matching tasks
 func listTasks(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(tasks)
+	query, err := taskQueryFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		log.Warn(err)
+		return
+	}
+	var resp []byte
+	engine.View(func() {
+		if !hasTaskQuery(r) {
+			resp, err = json.Marshal(inRequestLocation(r, tasks))
+			return
+		}
+		allTasks := []*Task{}
+		for _, task := range tasks {
+			allTasks = append(allTasks, task)
+		}
+		page, total := query.apply(allTasks)
+		resp, err = json.Marshal(inRequestLocation(r, TasksPage{Total: total, Offset: query.Offset, Limit: query.Limit, Tasks: page}))
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		log.Error(err)
+		return
+	}
+	w.Write(resp)
 }
 
+// showSchedule returns the schedule by zones; query parameters filter and page tasks of every zone
 func showSchedule(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
+	query, err := taskQueryFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		log.Warn(err)
+		return
+	}
 	scheduleResp := make(map[string][]PrettySchedule)
-	for zone, scheduleZone := range schedule {
-		scheduleResp[zone] = []PrettySchedule{}
-		for _, taskId := range scheduleZone {
-			prettySchedule := PrettySchedule {
-				Name: tasks[taskId].Name,
-				ID: taskId,
-				StartTime: tasks[taskId].StartDatetime.Format("15:04 02/01/2006"),
-				EndTime: tasks[taskId].StartDatetime.Add(tasks[taskId].Duration).Format("15:04 02/01/2006"),
-				Type: tasks[taskId].Type,
-				Critical: tasks[taskId].Critical,
+	loc := requestLocation(r)
+	engine.View(func() {
+		for zone, zoneSchedule := range schedule {
+			if len(query.Zones) > 0 && !containsString(query.Zones, zone) {
+				continue
+			}
+			zoneTasks := []*Task{}
+			for _, taskId := range zoneSchedule.taskIDs() {
+				zoneTasks = append(zoneTasks, tasks[taskId])
+			}
+			page, _ := query.apply(zoneTasks)
+			scheduleResp[zone] = []PrettySchedule{}
+			for _, task := range page {
+				taskId := task.ID
+				prettySchedule := PrettySchedule {
+					Name: tasks[taskId].Name,
+					ID: taskId,
+					StartTime: tasks[taskId].StartDatetime.In(loc).Format("15:04 02/01/2006"),
+					EndTime: tasks[taskId].StartDatetime.Add(tasks[taskId].Duration).In(loc).Format("15:04 02/01/2006"),
+					Type: tasks[taskId].Type,
+					Critical: tasks[taskId].Critical,
+					ParentID: tasks[taskId].ParentID,
+				}
+				scheduleResp[zone] = append(scheduleResp[zone], prettySchedule)
 			}
-			scheduleResp[zone] = append(scheduleResp[zone], prettySchedule)
 		}
-	}
+	})
 	json.NewEncoder(w).Encode(scheduleResp)
 }
 
 func getTask(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
 	taskID := mux.Vars(r)["uuid"]
-	task, ok := tasks[taskID]
+	var resp []byte
+	var err error
+	ok := false
+	engine.View(func() {
+		var task *Task
+		task, ok = tasks[taskID]
+		if ok {
+			resp, err = json.Marshal(inRequestLocation(r, newTaskDetailResp(task)))
+		}
+	})
 	if ok {
-		json.NewEncoder(w).Encode(task)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			log.Error(err)
+			return
+		}
+		w.Write(resp)
 		return
 	}
-	http.Error(w, fmt.Sprintf("No task with this ID %s", taskID), http.StatusBadRequest)
+	writeError(w, http.StatusBadRequest, newAPIError(codeTaskNotFound, "No task with this ID %s", taskID))
 }
 
 func deleteTask(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
 	taskID := mux.Vars(r)["uuid"]
-	_, ok := tasks[taskID]
-	if ok {
+	var resp []byte
+	apply := func() error {
+		task, ok := tasks[taskID]
+		if !ok {
+			return newAPIError(codeTaskNotFound, "No task with this ID %s", taskID)
+		}
+		if active := activeDependents(taskID); len(active) > 0 {
+			return &APIError{
+				Code: codeHasDependents,
+				Message: fmt.Sprintf("can't cancel task %s while tasks depending on it are not cancelled", taskID),
+				TaskIDs: active,
+			}
+		}
 		cancelTask(taskID)
-		w.WriteHeader(http.StatusOK)
-		log.Info("Cancelled task ", taskID)
+		for _, childID := range task.Children { // cancelling a split or rollout task cancels its per-zone tasks that haven't started
+			if child, ok := tasks[childID]; ok && (child.Status == "wait" || child.Status == "paused") {
+				cancelTask(childID)
+			}
+		}
+		var err error
+		resp, err = json.Marshal(inRequestLocation(r, task))
+		return err
+	}
+	if isDryRun(r) {
+		writeDryRun(w, r, apply, &resp, taskID)
+		return
+	}
+	err := engine.Update(apply)
+	if err != nil {
+		updateError(w, r, err)
 		return
 	}
-	http.Error(w, fmt.Sprintf("No task with this ID %s", taskID), http.StatusBadRequest)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info("Cancelled task ", taskID)
 }
 
 func extendTask(w http.ResponseWriter, r *http.Request) {
@@ -236,7 +362,7 @@ func extendTask(w http.ResponseWriter, r *http.Request) {
 	var extendTaskReq ExtendTaskReq
 	reqBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, err)
 		log.Warn(err)
 		return
 	}
@@ -245,41 +371,49 @@ func extendTask(w http.ResponseWriter, r *http.Request) {
 	// time conversion and validation
 	newDuration, err := time.ParseDuration(extendTaskReq.NewDuration)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, err)
 		log.Warn(err)
 		return
 	}
 
 	taskID := mux.Vars(r)["uuid"]
-	task, ok := tasks[taskID]
-	if ok {
-		if task.Type == "manual" && task.Status == "progress" {
-			if newDuration < task.Duration {
-				http.Error(w, "Can only extend tasks", http.StatusBadRequest)
-				log.Warn("Can only extend tasks ", taskID)
-				return
-			}
-			task.Duration = newDuration
-			err := scheduleTask(task, "change")
-			if err != nil {
-				suggestion := suggestTimeString(*task)
-				suggestion = err.Error() + "\n" + suggestion
-				http.Error(w, suggestion, http.StatusBadRequest)
-				log.Warn(suggestion)
-				return
-			}
-
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(task)
-			log.Info("Extended task ", taskID)
-			return
-		} else {
-			http.Error(w, "Can only extend manual tasks in progress", http.StatusBadRequest)
-			log.Warn("Can only extend manual tasks in progress", taskID)
-			return
+	var resp []byte
+	apply := func() error {
+		task, ok := tasks[taskID]
+		if !ok {
+			return newAPIError(codeTaskNotFound, "No task with this ID %s", taskID)
+		}
+		if task.Type != "manual" || task.Status != "progress" {
+			return newAPIError(codeInvalidStatus, "Can only extend manual tasks in progress %s", taskID)
+		}
+		if newDuration < task.Duration {
+			return newAPIError(codeInvalidRequest, "Can only extend tasks %s", taskID)
 		}
+		err := validateDuration(task.Type, task.Critical, newDuration)
+		if err != nil {
+			return err
+		}
+		task.Duration = newDuration
+		err = scheduleTask(task, "change")
+		if err != nil {
+			return withSuggestions(err, *task)
+		}
+		resp, err = json.Marshal(inRequestLocation(r, newTaskResp(task)))
+		return err
+	}
+	if isDryRun(r) {
+		writeDryRun(w, r, apply, &resp, taskID)
+		return
 	}
-	http.Error(w, fmt.Sprintf("No task with this ID %s", taskID), http.StatusBadRequest)
+	err = engine.Update(apply)
+	if err != nil {
+		updateError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info("Extended task ", taskID)
 }
 
 func moveTask(w http.ResponseWriter, r *http.Request) {
@@ -287,50 +421,101 @@ func moveTask(w http.ResponseWriter, r *http.Request) {
 	var moveTaskReq MoveTaskReq
 	reqBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, err)
 		log.Warn(err)
 		return
 	}
 	json.Unmarshal(reqBody, &moveTaskReq)
 
 	// time conversion and validation
-	newStartDatetime, err := time.Parse("02/01/2006 15:04", moveTaskReq.NewStartDateTime)
+	newStartDatetime, err := parseDatetime(moveTaskReq.NewStartDateTime, requestLocation(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, err)
 		log.Warn(err)
 		return
 	}
-	if newStartDatetime.Before(time.Now()) {
-		err = fmt.Errorf("can't set tasks in the past")
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if newStartDatetime.Before(clock.Now()) {
+		err = newAPIError(codePastStart, "can't set tasks in the past")
+		writeError(w, http.StatusBadRequest, err)
 		log.Warn(err)
 		return
 	}
 
 	taskID := mux.Vars(r)["uuid"]
-	task, ok := tasks[taskID]
-	if ok {
+	var resp []byte
+	apply := func() error {
+		task, ok := tasks[taskID]
+		if !ok {
+			return newAPIError(codeTaskNotFound, "No task with this ID %s", taskID)
+		}
 		if task.Status != "wait" {
-			http.Error(w, "Can only move tasks in wait", http.StatusBadRequest)
-			log.Warn("Can only move tasks in wait", taskID)
-			return
+			return newAPIError(codeInvalidStatus, "Can only move tasks in wait %s", taskID)
+		}
+		task.StartDatetime = roundStart(task.Type, newStartDatetime)
+		if task.StartDatetime.Add(task.Duration).After(task.Deadline) {
+			return newAPIError(codeDeadlineBeforeEnd, "can't move task past its deadline %v", task.Deadline)
 		}
-		startDatetime := task.StartDatetime
-		task.StartDatetime = newStartDatetime
 		err := scheduleTask(task, "change")
 		if err != nil {
-			task.StartDatetime = startDatetime
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			log.Warn(err)
-			return
+			return err
 		}
+		resp, err = json.Marshal(inRequestLocation(r, newTaskResp(task)))
+		return err
+	}
+	if isDryRun(r) {
+		writeDryRun(w, r, apply, &resp, taskID)
+		return
+	}
+	err = engine.Update(apply)
+	if err != nil {
+		updateError(w, r, err)
+		return
+	}
 
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(task)
-		log.Info("Moved task ", taskID)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info("Moved task ", taskID)
+}
+
+// updateError reports a failed engine update: persistence failures are server errors, the rest are rejected requests
+func updateError(w http.ResponseWriter, r *http.Request, err error) {
+	var persistErr *persistError
+	if errors.As(err, &persistErr) {
+		writeError(w, http.StatusInternalServerError, asAPIError(err, codeStore))
+		log.Error(err)
+		return
+	}
+	// suggestions are rendered in the request timezone
+	writeError(w, http.StatusBadRequest, inRequestLocation(r, asAPIError(err, codeInvalidRequest)).(*APIError))
+	log.Warn(err)
+}
+
+func isDryRun(r *http.Request) bool {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	return dryRun
+}
+
+// writeDryRun runs the operation like a real request and reports what it would change, leaving the state untouched;
+// resp is the task as it would be
+func writeDryRun(w http.ResponseWriter, r *http.Request, apply func() error, resp *[]byte, subjects ...string) {
+	writeDryRunResp(w, r, apply, func(dryRunResp *DryRunResp) {
+		dryRunResp.Task = *resp
+	}, func() []string {
+		return subjects
+	})
+}
+
+// writeDryRunResp is writeDryRun for operations on series and freezes: fill sets what they would be,
+// subjects are called after the operation as its tasks may only exist then
+func writeDryRunResp(w http.ResponseWriter, r *http.Request, apply func() error, fill func(dryRunResp *DryRunResp), subjects func() []string) {
+	changes, err := engine.Simulate(apply, subjects)
+	if err != nil {
+		updateError(w, r, err)
 		return
 	}
-	http.Error(w, "No task with this ID", http.StatusBadRequest)
+	dryRunResp := DryRunResp{DryRun: true, Changes: changes}
+	fill(&dryRunResp)
+	json.NewEncoder(w).Encode(inRequestLocation(r, dryRunResp))
 }
 
 func loggingMiddleware(next http.Handler) http.Handler {
@@ -344,6 +529,8 @@ func main() {
 	debug := flag.Bool("debug", false, "Debug mode")
 	port := flag.Int("port", 8080, "Server port")
 	configsDir := flag.String("configs", "./configs", "Configurations directory")
+	dataDir := flag.String("data", "", "Data directory for persisted tasks and schedule (in-memory if empty)")
+	tick := flag.Duration("tick", 30 * time.Second, "Interval of task lifecycle checks (wait -> progress -> complete)")
 	flag.Parse()
 	if *debug {
 		log.SetLevel(log.DebugLevel)
@@ -380,35 +567,110 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	err = loadTimezones()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = loadFreezes()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = loadPlacement()
+	if err != nil {
+		log.Fatal(err)
+	}
 	log.Debug("Config loaded:\n", config)
+
+	// restore tasks and schedule persisted before the last shutdown
+	store, err = newStore(*dataDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	state, err := store.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	tasks = state.Tasks
+	schedule = indexSchedule(state.Schedule)
+	recurringSeries = state.Series
+	freezes = state.Freezes
+	reloadReports = state.Reports
+	log.Debug(fmt.Sprintf("Restored %d tasks, %d series and %d freezes", len(tasks), len(recurringSeries), len(freezes)))
+
 	viper.WatchConfig()  // watches only the last config
 	viper.OnConfigChange(func(e fsnotify.Event) {
 		log.Info("Config file changed:", e.Name)
-		config = Config{}
-		err = viper.Unmarshal(&config)
-		if err != nil {
-			log.Fatal(err)
-		}
-		err = loadWhiteList()
-		if err != nil {
-			log.Fatal(err)
-		}
-		log.Debug("Config loaded:\n", config)
-		err = reschedule()
+		var report *ReloadReport
+		var webhooks []string
+		err := engine.Update(func() error {
+			config = Config{}
+			err := viper.Unmarshal(&config)
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = loadWhiteList()
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = loadTimezones()
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = loadFreezes()
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = loadPlacement()
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Debug("Config loaded:\n", config)
+			configGeneration++
+			report = rescheduleWithReport(e.Name)
+			webhooks = config.Webhooks
+			return nil
+		})
 		if err != nil {
-			log.Warn(fmt.Sprintf("Rescheduling errors: %s", err.Error()))
+			log.Error(err)
+			return
 		}
+		log.Info(fmt.Sprintf("Rescheduled on config reload: %d kept, %d moved, %d compressed, %d cancelled (report %s)", len(report.Kept), len(report.Moved), len(report.Compressed), len(report.Cancelled), report.ID))
+		notifyReload(report, webhooks)
 	})
 
 	router := mux.NewRouter()
 	router.Path("/tasks").Methods("POST").HandlerFunc(addTask)
 	router.Path("/tasks").Methods("GET").HandlerFunc(listTasks)
 	router.Path("/schedule").Methods("GET").HandlerFunc(showSchedule)
+	router.Path("/schedule.ics").Methods("GET").HandlerFunc(showScheduleICS)
 	router.Path("/tasks/{uuid}").Methods("GET").HandlerFunc(getTask)
+	router.Path("/tasks/{uuid}/preemptions").Methods("GET").HandlerFunc(listPreemptions)
 	router.Path("/tasks/{uuid}").Methods("DELETE").HandlerFunc(deleteTask)
 	router.Path("/tasks/extend/{uuid}").Methods("PUT").HandlerFunc(extendTask)
 	router.Path("/tasks/move/{uuid}").Methods("PUT").HandlerFunc(moveTask)
+	router.Path("/tasks/dependencies/{uuid}").Methods("PUT").HandlerFunc(setDependencies)
+	router.Path("/tasks/resume/{uuid}").Methods("PUT").HandlerFunc(resumeRollout)
+	router.Path("/series").Methods("POST").HandlerFunc(addSeries)
+	router.Path("/series").Methods("GET").HandlerFunc(listSeries)
+	router.Path("/series/{uuid}").Methods("GET").HandlerFunc(getSeries)
+	router.Path("/series/{uuid}").Methods("PUT").HandlerFunc(editSeries)
+	router.Path("/series/{uuid}").Methods("DELETE").HandlerFunc(deleteSeries)
+	router.Path("/series/{uuid}/occurrences").Methods("PUT").HandlerFunc(overrideOccurrence)
+	router.Path("/freezes").Methods("POST").HandlerFunc(addFreeze)
+	router.Path("/freezes").Methods("GET").HandlerFunc(listFreezes)
+	router.Path("/freezes/import").Methods("POST").HandlerFunc(importFreezes)
+	router.Path("/freezes/{uuid}").Methods("DELETE").HandlerFunc(deleteFreeze)
+	router.Path("/slots").Methods("GET").HandlerFunc(showFreeSlots)
+	router.Path("/suggestions").Methods("GET", "POST").HandlerFunc(showSuggestions)
+	router.Path("/optimize").Methods("POST").HandlerFunc(previewOptimization)
+	router.Path("/optimize/{uuid}/commit").Methods("POST").HandlerFunc(commitOptimization)
+	router.Path("/reloads").Methods("GET").HandlerFunc(listReloadReports)
+	router.Path("/reloads/{uuid}").Methods("GET").HandlerFunc(getReloadReport)
+	router.Path("/executor/claim").Methods("POST").HandlerFunc(claimTask)
+	router.Path("/executor/heartbeat/{uuid}").Methods("PUT").HandlerFunc(heartbeatTask)
+	router.Path("/executor/report/{uuid}").Methods("PUT").HandlerFunc(reportTask)
 	router.Use(loggingMiddleware)
+	router.Use(timezoneMiddleware)
 
 	srv := &http.Server{
 		Handler: router,
@@ -424,12 +686,19 @@ func main() {
 			log.Warn(err)
 		}
 	}()
+	lifecycleCtx, stopLifecycle := context.WithCancel(context.Background())
+	go runLifecycle(lifecycleCtx, *tick)
+	go runPeriodicOptimizer(lifecycleCtx)
 	c := make(chan os.Signal, 1)
     signal.Notify(c, os.Interrupt) // quit via SIGINT (Ctrl+C)
     <-c
+    stopLifecycle()
     ctx, cancel := context.WithTimeout(context.Background(), time.Second * 15)
     defer cancel()
     srv.Shutdown(ctx) // graceful shutdown
+    if err := engine.Close(); err != nil {
+    	log.Warn(err)
+    }
     log.Info("Shutting down...")
     os.Exit(0)
 }
\ No newline at end of file
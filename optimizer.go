@@ -0,0 +1,547 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// OptimizerConfig is the optimizer section of the common config
+type OptimizerConfig struct {
+	Interval          time.Duration `mapstructure:"interval"`          // periodic re-planning; off if 0
+	Budget            time.Duration `mapstructure:"budget"`            // time budget of a run, 2s by default
+	Iterations        int           `mapstructure:"iterations"`        // iterations of a run, 5000 by default
+	DisplacementCost  time.Duration `mapstructure:"displacementCost"`  // lateness of an auto task a displaced task is worth, 1h by default
+	CompressionWeight float64       `mapstructure:"compressionWeight"` // cost of a compressed minute, 1 by default
+}
+
+// maxOptimizerBudget keeps previews within the HTTP write timeout
+const maxOptimizerBudget = 10 * time.Second
+
+func optimizerSettings() OptimizerConfig {
+	settings := config.Optimizer
+	if settings.Budget <= 0 {
+		settings.Budget = 2 * time.Second
+	}
+	if settings.Iterations <= 0 {
+		settings.Iterations = 5000
+	}
+	if settings.DisplacementCost <= 0 {
+		settings.DisplacementCost = time.Hour
+	}
+	if settings.CompressionWeight <= 0 {
+		settings.CompressionWeight = 1
+	}
+	return settings
+}
+
+// latenessWeights weigh minutes after the preferred start by task priority
+var latenessWeights = map[int]int64{0: 4, 1: 2, 2: 1}
+
+// PlanCost is the objective the optimizer minimizes, in minutes of lateness of an auto task
+type PlanCost struct {
+	Lateness      float64 // weighted minutes waiting tasks start after their preferred start
+	Compression   float64 // minutes per-zone tasks lost to compression
+	Displacements int     // waiting tasks moved later than their slot before the run or split
+	Total         float64
+}
+
+// OptimizationPlan is the schedule found by an optimizer run; previews are kept until committed or stale
+type OptimizationPlan struct {
+	ID         string
+	CreatedAt  time.Time
+	Budget     time.Duration
+	Iterations int
+	TimedOut   bool     // the budget ran out before all iterations, so the run can't be reproduced with its seed
+	BaseCost   PlanCost // cost of the schedule the run started from
+	Cost       PlanCost
+	Committed  bool
+	Changes
+
+	fingerprint string
+	tasks       map[string]Task // tasks changed or added by the plan
+	schedule    map[string]*zoneIndex
+}
+
+// optimizationPlan is the last preview; committing it is refused once tasks, freezes or config change
+var optimizationPlan *OptimizationPlan
+
+// configGeneration is incremented on every config reload
+var configGeneration int
+
+// stateFingerprint changes whenever a task, freeze or the config does
+func stateFingerprint() string {
+	keys := []string{}
+	for taskID, task := range tasks {
+		keys = append(keys, fmt.Sprintf("task/%s/%d/%s", taskID, task.Revision, task.Status))
+	}
+	for freezeID := range freezes {
+		keys = append(keys, "freeze/"+freezeID)
+	}
+	sort.Strings(keys)
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "config/%d", configGeneration)
+	for _, key := range keys {
+		hash.Write([]byte(key))
+	}
+	return strconv.FormatUint(hash.Sum64(), 16)
+}
+
+// stateSeed seeds periodic runs from the state, so the same tasks, freezes and config are always re-planned the same way
+func stateSeed() int64 {
+	seed, _ := strconv.ParseUint(stateFingerprint(), 16, 64)
+	return int64(seed)
+}
+
+// optimizationBase is the state an optimizer run started from
+type optimizationBase struct {
+	snapshot  stateSnapshot
+	scheduled map[string]bool
+	settings  OptimizerConfig
+}
+
+// referenceStart is the start lateness is counted from: the preferred start, or the slot before the run
+// for tasks without one (per-zone tasks of split tasks fall back to their parent)
+func (base optimizationBase) referenceStart(task *Task) time.Time {
+	if !task.PreferredStartDatetime.IsZero() {
+		return task.PreferredStartDatetime
+	}
+	if old, ok := base.snapshot.tasks[task.ID]; ok {
+		return old.StartDatetime
+	}
+	if parent, ok := base.snapshot.tasks[task.ParentID]; ok {
+		return parent.StartDatetime
+	}
+	return task.StartDatetime
+}
+
+// cost of the current state; false if a task waiting before the run has lost its slot
+func (base optimizationBase) cost() (PlanCost, bool) {
+	var compression time.Duration
+	weightedLateness := int64(0) // seconds, summed as integers so the cost doesn't depend on map order
+	displacements := 0
+	scheduled := scheduledTaskIds(schedule)
+	for taskID, task := range tasks {
+		if task.Status != "wait" || !scheduled[taskID] {
+			continue
+		}
+		if late := task.StartDatetime.Sub(base.referenceStart(task)); late > 0 {
+			weightedLateness += latenessWeights[task.Priority] * int64(late/time.Second)
+		}
+		if parent, ok := tasks[task.ParentID]; ok && parent.Status == "split" && parent.CompressionPerc > 0 {
+			compression += parent.Duration - task.Duration
+		}
+	}
+	for taskID, old := range base.snapshot.tasks {
+		if old.Status != "wait" || !base.scheduled[taskID] {
+			continue
+		}
+		task, ok := tasks[taskID]
+		switch {
+		case ok && task.Status == "split":
+			displacements++
+		case !ok || !scheduled[taskID]:
+			return PlanCost{}, false
+		case task.StartDatetime.After(old.StartDatetime):
+			displacements++
+		}
+	}
+	cost := PlanCost{
+		Lateness:      (time.Duration(weightedLateness) * time.Second).Minutes(),
+		Compression:   compression.Minutes(),
+		Displacements: displacements,
+	}
+	cost.Total = cost.Lateness + cost.Compression*base.settings.CompressionWeight + float64(displacements)*base.settings.DisplacementCost.Minutes()
+	return cost, true
+}
+
+// movableTasks lists IDs of waiting tasks that haven't started, ordered by ID
+func movableTasks(now time.Time) []string {
+	movable := []string{}
+	for taskID, task := range tasks {
+		if task.Status == "wait" && task.StartDatetime.After(now) && isScheduled(taskID) {
+			movable = append(movable, taskID)
+		}
+	}
+	sort.Strings(movable)
+	return movable
+}
+
+// alnsOperator is a destroy or repair heuristic chosen with probability proportional to its weight;
+// weights follow the scores the operator earned in the last segment of iterations
+type alnsOperator struct {
+	name   string
+	weight float64
+	score  float64
+	uses   int
+}
+
+// ALNS scores (Ropke & Pisinger): new best, better than current, accepted worse
+const (
+	alnsScoreBest     = 33
+	alnsScoreBetter   = 9
+	alnsScoreAccepted = 13
+	alnsSegment       = 50
+	alnsReaction      = 0.1
+)
+
+func pickOperator(operators []*alnsOperator, rng *rand.Rand) *alnsOperator {
+	total := 0.0
+	for _, operator := range operators {
+		total += operator.weight
+	}
+	r := rng.Float64() * total
+	for _, operator := range operators {
+		if r < operator.weight {
+			return operator
+		}
+		r -= operator.weight
+	}
+	return operators[len(operators)-1]
+}
+
+func updateWeights(operators []*alnsOperator) {
+	for _, operator := range operators {
+		if operator.uses > 0 {
+			operator.weight = (1-alnsReaction)*operator.weight + alnsReaction*operator.score/float64(operator.uses)
+		}
+		if operator.weight < 0.1 {
+			operator.weight = 0.1
+		}
+		operator.score, operator.uses = 0, 0
+	}
+}
+
+// destroy picks tasks to take out of the schedule: random ones, the latest against their reference start
+// or ones close in time to a random task, preferring its zones
+func destroy(operator string, movable []string, base optimizationBase, rng *rand.Rand) []string {
+	removeCount := len(movable) / 5
+	if removeCount < 2 {
+		removeCount = 2
+	}
+	if removeCount > 25 {
+		removeCount = 25
+	}
+	if removeCount > len(movable) {
+		removeCount = len(movable)
+	}
+	removeCount = 1 + rng.Intn(removeCount)
+	candidates := append([]string{}, movable...)
+	switch operator {
+	case "worst":
+		lateness := func(taskID string) time.Duration {
+			task := tasks[taskID]
+			return time.Duration(latenessWeights[task.Priority]) * task.StartDatetime.Sub(base.referenceStart(task))
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return lateness(candidates[i]) > lateness(candidates[j])
+		})
+		removed := []string{}
+		for len(removed) < removeCount {
+			i := int(math.Pow(rng.Float64(), 3) * float64(len(candidates))) // biased to the latest
+			removed = append(removed, candidates[i])
+			candidates = append(candidates[:i], candidates[i+1:]...)
+		}
+		return removed
+	case "related":
+		seed := tasks[candidates[rng.Intn(len(candidates))]]
+		distance := func(taskID string) time.Duration {
+			task := tasks[taskID]
+			d := task.StartDatetime.Sub(seed.StartDatetime)
+			if d < 0 {
+				d = -d
+			}
+			for _, zone := range task.Zones {
+				if containsString(seed.Zones, zone) {
+					return d
+				}
+			}
+			return 2*d + time.Hour
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return distance(candidates[i]) < distance(candidates[j])
+		})
+		return candidates[:removeCount]
+	}
+	rng.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	return candidates[:removeCount]
+}
+
+// repair places removed tasks one by one in the earliest slot from their reference start, by priority,
+// in random order or by deadline; false if one of them fits nowhere
+func repair(operator string, removed []string, base optimizationBase, now time.Time, rng *rand.Rand) bool {
+	switch operator {
+	case "greedy":
+		sort.SliceStable(removed, func(i, j int) bool {
+			a, b := tasks[removed[i]], tasks[removed[j]]
+			if a.Priority != b.Priority {
+				return a.Priority < b.Priority
+			}
+			return base.referenceStart(a).Before(base.referenceStart(b))
+		})
+	case "deadline":
+		sort.SliceStable(removed, func(i, j int) bool {
+			return tasks[removed[i]].Deadline.Before(tasks[removed[j]].Deadline)
+		})
+	default:
+		rng.Shuffle(len(removed), func(i, j int) {
+			removed[i], removed[j] = removed[j], removed[i]
+		})
+	}
+	for _, taskID := range removed {
+		task := tasks[taskID]
+		if task.Status != "wait" || isScheduled(taskID) { // split or re-placed by a cascade
+			continue
+		}
+		start := base.referenceStart(task)
+		if start.Before(now) {
+			start = now
+		}
+		task.StartDatetime = roundStart(task.Type, start)
+		if !placeEarliest(task) {
+			return false
+		}
+	}
+	return true
+}
+
+// optimizeSchedule re-plans waiting tasks with adaptive large neighbourhood search: every iteration takes some tasks
+// out of the schedule and places them again with operators chosen by their past success; worse schedules are accepted
+// with simulated annealing. The best schedule found is left in place. The run stops after settings.Iterations,
+// so it depends only on the state and rng, or earlier with timedOut when the budget runs out
+func optimizeSchedule(settings OptimizerConfig, rng *rand.Rand) (iterations int, timedOut bool, baseCost PlanCost, bestCost PlanCost) {
+	now := clock.Now()
+	base := optimizationBase{snapshot: snapshotState(), settings: settings}
+	base.scheduled = scheduledTaskIds(base.snapshot.schedule)
+	baseCost, _ = base.cost()
+	bestCost = baseCost
+	if len(movableTasks(now)) == 0 {
+		return 0, false, baseCost, bestCost
+	}
+	current, best := base.snapshot, base.snapshot
+	currentCost := baseCost
+	destroyOperators := []*alnsOperator{{name: "random", weight: 1}, {name: "worst", weight: 1}, {name: "related", weight: 1}}
+	repairOperators := []*alnsOperator{{name: "greedy", weight: 1}, {name: "random", weight: 1}, {name: "deadline", weight: 1}}
+	// a schedule 5% worse than the initial one is accepted with probability 1/2 at first
+	initialTemperature := 0.05 * baseCost.Total / math.Ln2
+	if initialTemperature <= 0 {
+		initialTemperature = 1
+	}
+	started := time.Now()
+	for iterations < settings.Iterations {
+		if time.Since(started) >= settings.Budget {
+			timedOut = true
+			break
+		}
+		iterations++
+		restoreState(current)
+		movable := movableTasks(now)
+		if len(movable) == 0 {
+			break
+		}
+		destroyOperator, repairOperator := pickOperator(destroyOperators, rng), pickOperator(repairOperators, rng)
+		destroyOperator.uses++
+		repairOperator.uses++
+		removed := destroy(destroyOperator.name, movable, base, rng)
+		for _, taskID := range removed {
+			unscheduleTask(taskID)
+		}
+		if !repair(repairOperator.name, removed, base, now, rng) {
+			continue
+		}
+		cost, feasible := base.cost()
+		if !feasible {
+			continue
+		}
+		temperature := initialTemperature * (1 - float64(iterations)/float64(settings.Iterations))
+		score := 0.0
+		switch {
+		case cost.Total < bestCost.Total:
+			best, bestCost = snapshotState(), cost
+			current, currentCost = best, cost
+			score = alnsScoreBest
+		case cost.Total < currentCost.Total:
+			current, currentCost = snapshotState(), cost
+			score = alnsScoreBetter
+		case temperature > 0 && rng.Float64() < math.Exp((currentCost.Total-cost.Total)/temperature):
+			current, currentCost = snapshotState(), cost
+			score = alnsScoreAccepted
+		}
+		destroyOperator.score += score
+		repairOperator.score += score
+		if iterations%alnsSegment == 0 {
+			updateWeights(destroyOperators)
+			updateWeights(repairOperators)
+		}
+	}
+	restoreState(best)
+	return iterations, timedOut, baseCost, bestCost
+}
+
+// runOptimizer runs the optimizer on the state and returns the plan, leaving the planned schedule in place
+func runOptimizer(settings OptimizerConfig, rng *rand.Rand) *OptimizationPlan {
+	before := snapshotState()
+	plan := &OptimizationPlan{
+		ID:          uuid.New().String(),
+		CreatedAt:   clock.Now(),
+		Budget:      settings.Budget,
+		fingerprint: stateFingerprint(),
+		tasks:       make(map[string]Task),
+		schedule:    make(map[string]*zoneIndex, len(schedule)),
+	}
+	plan.Iterations, plan.TimedOut, plan.BaseCost, plan.Cost = optimizeSchedule(settings, rng)
+	plan.Changes = diffState(before)
+	for taskID, task := range tasks {
+		if old, ok := before.tasks[taskID]; !ok || !reflect.DeepEqual(old, task.clone()) {
+			plan.tasks[taskID] = task.clone()
+		}
+	}
+	for zone, zoneSchedule := range schedule {
+		plan.schedule[zone] = zoneSchedule.clone()
+	}
+	return plan
+}
+
+func applyPlan(plan *OptimizationPlan) {
+	for taskID, task := range plan.tasks {
+		task = task.clone()
+		if current, ok := tasks[taskID]; ok {
+			*current = task
+			continue
+		}
+		tasks[taskID] = &task
+	}
+	schedule = make(map[string]*zoneIndex, len(plan.schedule))
+	for zone, zoneSchedule := range plan.schedule {
+		schedule[zone] = zoneSchedule.clone()
+	}
+}
+
+// previewOptimization runs the optimizer without changing the schedule and keeps the plan for committing;
+// ?budget= overrides the configured time budget and ?seed= makes the run reproducible unless it times out.
+// The run holds the engine lock, so other requests wait for up to the budget
+func previewOptimization(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	query := r.URL.Query()
+	var settings OptimizerConfig
+	engine.View(func() {
+		settings = optimizerSettings()
+	})
+	if budgetParam := query.Get("budget"); budgetParam != "" {
+		budget, err := time.ParseDuration(budgetParam)
+		if err != nil || budget <= 0 || budget > maxOptimizerBudget {
+			writeError(w, http.StatusBadRequest, newAPIError(codeInvalidRequest, "invalid budget: %s (up to %v)", budgetParam, maxOptimizerBudget))
+			return
+		}
+		settings.Budget = budget
+	}
+	if settings.Budget > maxOptimizerBudget {
+		settings.Budget = maxOptimizerBudget
+	}
+	seed := time.Now().UnixNano()
+	if seedParam := query.Get("seed"); seedParam != "" {
+		var err error
+		seed, err = strconv.ParseInt(seedParam, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, newAPIError(codeInvalidRequest, "invalid seed: %s", seedParam))
+			return
+		}
+	}
+	var resp []byte
+	_, err := engine.Simulate(func() error {
+		plan := runOptimizer(settings, rand.New(rand.NewSource(seed)))
+		optimizationPlan = plan
+		var err error
+		resp, err = json.Marshal(inRequestLocation(r, plan))
+		return err
+	}, nil)
+	if err != nil {
+		updateError(w, r, err)
+		return
+	}
+	w.Write(resp)
+	log.Info("Previewed optimization plan")
+}
+
+// commitOptimization applies the previewed plan if nothing changed since it was made
+func commitOptimization(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	planID := mux.Vars(r)["uuid"]
+	var resp []byte
+	err := engine.Update(func() error {
+		plan := optimizationPlan
+		if plan == nil || plan.ID != planID {
+			return newAPIError(codePlanNotFound, "No optimization plan with this ID %s (only the last preview can be committed)", planID)
+		}
+		if plan.fingerprint != stateFingerprint() {
+			return newAPIError(codePlanStale, "tasks, freezes or config changed since plan %s was made; preview again", planID)
+		}
+		applyPlan(plan)
+		optimizationPlan = nil
+		committed := *plan
+		committed.Committed = true
+		committed.Changes = engine.Changes()
+		var err error
+		resp, err = json.Marshal(inRequestLocation(r, committed))
+		return err
+	})
+	if err != nil {
+		updateError(w, r, err)
+		return
+	}
+	w.Write(resp)
+	log.Info("Committed optimization plan ", planID)
+}
+
+// runPeriodicOptimizer re-plans the schedule every optimizer interval from config (checked every minute)
+// and keeps the result if it costs less; runs are seeded from the state and hold the engine lock like previews
+func runPeriodicOptimizer(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	lastRun := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var settings OptimizerConfig
+			engine.View(func() {
+				settings = optimizerSettings()
+			})
+			if settings.Interval <= 0 || time.Since(lastRun) < settings.Interval {
+				continue
+			}
+			lastRun = time.Now()
+			if settings.Budget > maxOptimizerBudget {
+				settings.Budget = maxOptimizerBudget
+			}
+			err := engine.Update(func() error {
+				seed := stateSeed()
+				plan := runOptimizer(settings, rand.New(rand.NewSource(seed)))
+				optimizationPlan = nil
+				log.Info(fmt.Sprintf("Optimized schedule with seed %d in %d iterations: cost %.1f -> %.1f, %d tasks moved", seed, plan.Iterations, plan.BaseCost.Total, plan.Cost.Total, len(plan.Displaced)))
+				if plan.TimedOut {
+					log.Warn(fmt.Sprintf("Optimizer ran out of its %v budget after %d of %d iterations", settings.Budget, plan.Iterations, settings.Iterations))
+				}
+				return nil
+			})
+			if err != nil {
+				log.Error(err)
+			}
+		}
+	}
+}
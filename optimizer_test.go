@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOptimizerIsReproducibleWithSeed(t *testing.T) {
+	setupState(t, "dev1", "dev2")
+	// tasks placed in arrival order all prefer the same start and the longest come first, so most of them end up late
+	for i := 0; i < 30; i++ {
+		zones := []string{"dev1", "dev2"}[:1+i%2]
+		task := newTestTask(fmt.Sprintf("t%02d", i), "auto", testStart.Add(time.Hour), time.Duration(90-2*i)*time.Minute, zones...)
+		tasks[task.ID] = task
+		if !placeEarliest(task) {
+			t.Fatalf("task %s not placed", task.ID)
+		}
+	}
+	before := snapshotState()
+	settings := OptimizerConfig{Budget: time.Minute, Iterations: 200, DisplacementCost: time.Minute, CompressionWeight: 1}
+
+	first := runOptimizer(settings, rand.New(rand.NewSource(1)))
+	firstSchedule, firstStarts := scheduleTaskIDs(), taskStarts()
+	restoreState(before)
+	second := runOptimizer(settings, rand.New(rand.NewSource(1)))
+
+	if first.TimedOut || first.Iterations != settings.Iterations {
+		t.Fatalf("run did %d iterations (timed out: %t), want %d", first.Iterations, first.TimedOut, settings.Iterations)
+	}
+	if first.Cost.Total >= first.BaseCost.Total {
+		t.Fatalf("run didn't improve cost %.1f", first.BaseCost.Total)
+	}
+	if first.Iterations != second.Iterations || first.Cost != second.Cost {
+		t.Fatalf("runs with the same seed differ: %d iterations at %+v and %d at %+v", first.Iterations, first.Cost, second.Iterations, second.Cost)
+	}
+	if !reflect.DeepEqual(firstSchedule, scheduleTaskIDs()) || !reflect.DeepEqual(firstStarts, taskStarts()) {
+		t.Fatal("runs with the same seed left different schedules")
+	}
+}
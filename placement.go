@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// placementPoints are the starts a strategy can try for a task in a zone
+type placementPoints struct {
+	starts []time.Time // points of interest from the task start (and its dependencies) up to the deadline, rounded and ordered
+	ends   []time.Time // starts, rounded down, at which the task would end at a point of interest or at its deadline
+	// fits tells if the task fits at the start in the zone and how many lower-priority tasks it would displace
+	fits func(start time.Time) (displaced int, ok bool)
+}
+
+// PlacementStrategy chooses where suggestTime places a task in a zone, e.g. a displaced task or a suggestion
+type PlacementStrategy interface {
+	place(task Task, points placementPoints) (time.Time, bool)
+}
+
+// earliestPlacement takes the earliest feasible start
+type earliestPlacement struct{}
+
+// closestPlacement takes the feasible start closest to the preferred start (the earlier one on ties)
+type closestPlacement struct{}
+
+// latestPlacement takes the latest feasible start before the deadline
+type latestPlacement struct{}
+
+// leastDisruptionPlacement takes the feasible start displacing the fewest lower-priority tasks (the earliest one on ties)
+type leastDisruptionPlacement struct{}
+
+const defaultPlacement = "earliest"
+
+var placementStrategies = map[string]PlacementStrategy{
+	"earliest":         earliestPlacement{},
+	"closest":          closestPlacement{},
+	"latest":           latestPlacement{},
+	"least-disruption": leastDisruptionPlacement{},
+}
+
+func firstFit(points placementPoints, starts []time.Time) (time.Time, bool) {
+	for _, start := range starts {
+		if _, ok := points.fits(start); ok {
+			return start, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (earliestPlacement) place(task Task, points placementPoints) (time.Time, bool) {
+	return firstFit(points, points.starts)
+}
+
+func (closestPlacement) place(task Task, points placementPoints) (time.Time, bool) {
+	preferred := task.PreferredStartDatetime
+	if preferred.IsZero() {
+		preferred = task.StartDatetime
+	}
+	starts := append([]time.Time{roundStart(task.Type, preferred)}, points.starts...)
+	starts = append(starts, points.ends...)
+	distance := func(start time.Time) time.Duration {
+		if start.Before(preferred) {
+			return preferred.Sub(start)
+		}
+		return start.Sub(preferred)
+	}
+	sort.Slice(starts, func(i, j int) bool {
+		if distance(starts[i]) != distance(starts[j]) {
+			return distance(starts[i]) < distance(starts[j])
+		}
+		return starts[i].Before(starts[j])
+	})
+	return firstFit(points, removeDuplicateTime(starts))
+}
+
+func (latestPlacement) place(task Task, points placementPoints) (time.Time, bool) {
+	starts := append(append([]time.Time{}, points.starts...), points.ends...)
+	sort.Slice(starts, func(i, j int) bool {
+		return starts[i].After(starts[j])
+	})
+	return firstFit(points, removeDuplicateTime(starts))
+}
+
+func (leastDisruptionPlacement) place(task Task, points placementPoints) (time.Time, bool) {
+	best, bestDisplaced, found := time.Time{}, 0, false
+	for _, start := range points.starts {
+		displaced, ok := points.fits(start)
+		if !ok || (found && displaced >= bestDisplaced) {
+			continue
+		}
+		best, bestDisplaced, found = start, displaced, true
+		if displaced == 0 {
+			break
+		}
+	}
+	return best, found
+}
+
+// placementStrategy is the strategy of the task, else of the zone in config, else the default one from config or earliest
+func placementStrategy(task Task, zone string) PlacementStrategy {
+	for _, name := range []string{task.Placement, config.Placement[zone], config.Placement["default"]} {
+		if strategy, ok := placementStrategies[name]; ok {
+			return strategy
+		}
+	}
+	return placementStrategies[defaultPlacement]
+}
+
+func validatePlacement(name string) error {
+	if _, ok := placementStrategies[name]; name != "" && !ok {
+		return newAPIError(codeInvalidRequest, "unknown placement strategy %s (earliest, closest, latest or least-disruption)", name)
+	}
+	return nil
+}
+
+func loadPlacement() error {
+	for zone, name := range config.Placement {
+		if err := validatePlacement(name); err != nil {
+			return fmt.Errorf("configuration error: placement of %s: %s", zone, err.Error())
+		}
+	}
+	return nil
+}
+
+// endAlignedStarts are starts, rounded down, at which the task ends at one of the points or at its deadline
+func endAlignedStarts(task Task, points []time.Time) []time.Time {
+	starts := []time.Time{roundStartDown(task.Type, task.Deadline.Add(-task.Duration))}
+	for _, point := range points {
+		if point.After(task.Deadline) {
+			break
+		}
+		starts = append(starts, roundStartDown(task.Type, point.Add(-task.Duration)))
+	}
+	return removeDuplicateTime(starts)
+}
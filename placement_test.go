@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlacementStrategies(t *testing.T) {
+	// an auto task takes 01:00-02:00 and a manual one 03:00-04:00; the new manual task can displace only the auto one
+	cases := []struct {
+		strategy string
+		want     time.Duration // after testStart
+	}{
+		{strategy: "earliest", want: time.Hour},                           // displaces the auto task
+		{strategy: "closest", want: 2 * time.Hour},                        // ends at the manual task, 30m before the preferred start
+		{strategy: "latest", want: 6 * time.Hour},                         // ends at the deadline
+		{strategy: "least-disruption", want: 4*time.Hour + 5*time.Minute}, // after the manual task and its pause
+	}
+	for _, c := range cases {
+		t.Run(c.strategy, func(t *testing.T) {
+			setupState(t, "dev1")
+			placeTestTask(newTestTask("x", "auto", testStart.Add(time.Hour), time.Hour, "dev1"))
+			placeTestTask(newTestTask("y", "manual", testStart.Add(3*time.Hour), time.Hour, "dev1"))
+			task := newTestTask("new", "manual", testStart.Add(time.Hour), time.Hour, "dev1")
+			task.PreferredStartDatetime = testStart.Add(2*time.Hour + 30*time.Minute)
+			task.Deadline = testStart.Add(7 * time.Hour)
+			task.Placement = c.strategy
+
+			points := suggestTime(*task)
+			if want := testStart.Add(c.want); !points["dev1"].Equal(want) {
+				t.Fatalf("placed at %v, want %v", points["dev1"], want)
+			}
+			if _, ok := tasks["x"]; !ok || !schedule["dev1"].contains("x") {
+				t.Fatal("suggesting a start displaced a task")
+			}
+		})
+	}
+}
+
+func TestPlacementStrategyPrecedence(t *testing.T) {
+	setupState(t, "dev1", "dev2", "dev3")
+	config.Placement = map[string]string{"default": "latest", "dev1": "closest"}
+	cases := []struct {
+		placement string
+		zone      string
+		want      PlacementStrategy
+	}{
+		{placement: "least-disruption", zone: "dev1", want: leastDisruptionPlacement{}},
+		{zone: "dev1", want: closestPlacement{}},
+		{zone: "dev2", want: latestPlacement{}},
+	}
+	for _, c := range cases {
+		if got := placementStrategy(Task{Placement: c.placement}, c.zone); got != c.want {
+			t.Errorf("strategy of a task with %q in %s is %T, want %T", c.placement, c.zone, got, c.want)
+		}
+	}
+	config.Placement = nil
+	if got := placementStrategy(Task{}, "dev3"); got != (earliestPlacement{}) {
+		t.Errorf("strategy without config is %T, want earliest", got)
+	}
+
+	config.Placement = map[string]string{"dev1": "random"}
+	if err := loadPlacement(); err == nil {
+		t.Error("unknown strategy in config is loaded")
+	}
+	if err := validatePlacement("random"); asAPIError(err, codeInternal).Code != codeInvalidRequest {
+		t.Errorf("unknown strategy of a task returned %v, want %s", err, codeInvalidRequest)
+	}
+}
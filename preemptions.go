@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// Placement is a slot a preempted task (or a per-zone task split from it) was re-placed to
+type Placement struct {
+	TaskID        string
+	Zones         []string
+	StartDatetime time.Time
+	EndDatetime   time.Time
+	Status        string `json:",omitempty"`
+}
+
+// Preemption records that a task lost its slot to a higher-priority task
+type Preemption struct {
+	TaskID           string // preempted task
+	PreemptedBy      string
+	Datetime         time.Time
+	OldStartDatetime time.Time
+	OldEndDatetime   time.Time
+	Outcome          string // moved, split into per-zone tasks, or cancelled when no slot is left for it (or any of its per-zone tasks)
+	Placements       []Placement
+}
+
+// preemptionLog collects preemptions made by the running engine operation, including cascading ones
+var preemptionLog []Preemption
+
+// recordPreemption stores the preemption in the history of the preempted task and in the operation log
+func recordPreemption(preemption Preemption) {
+	recordTask(preemption.TaskID)
+	task := tasks[preemption.TaskID]
+	task.Preemptions = append(task.Preemptions, preemption)
+	preemptionLog = append(preemptionLog, preemption)
+}
+
+func newTaskResp(task *Task) TaskResp {
+	resp := TaskResp{
+		Task:      task,
+		Preempted: append([]Preemption{}, preemptionLog...),
+	}
+	if len(task.Children) > 0 {
+		resp.Placements = childPlacements(task)
+	}
+	return resp
+}
+
+func listPreemptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	taskID := mux.Vars(r)["uuid"]
+	var resp []byte
+	var err error
+	ok := false
+	engine.View(func() {
+		var task *Task
+		task, ok = tasks[taskID]
+		if ok {
+			resp, err = json.Marshal(inRequestLocation(r, append([]Preemption{}, task.Preemptions...)))
+		}
+	})
+	if !ok {
+		writeError(w, http.StatusBadRequest, newAPIError(codeTaskNotFound, "No task with this ID %s", taskID))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		log.Error(err)
+		return
+	}
+	w.Write(resp)
+}
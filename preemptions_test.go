@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCriticalTaskCancelsUnplaceableDisplacedTask(t *testing.T) {
+	setupState(t, "dev1")
+	// the auto task has no other slot before its deadline
+	auto := newTestTask("a", "auto", testStart.Add(time.Hour), time.Hour, "dev1")
+	auto.Deadline = testStart.Add(2*time.Hour + 30*time.Minute)
+	placeTestTask(auto)
+
+	body := `{"Name": "hotfix", "Type": "manual", "Critical": true, "Zones": ["dev1"], "Duration": "1h",
+		"StartDatetime": "07/01/2030 01:00", "Deadline": "08/01/2030 01:00"}`
+	w := httptest.NewRecorder()
+	addTask(w, httptest.NewRequest("POST", "/tasks", strings.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("adding the critical task returned %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		ID        string
+		Preempted []Preemption
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !schedule["dev1"].contains(resp.ID) {
+		t.Fatal("critical task isn't scheduled")
+	}
+	if auto.Status != "cancel" || schedule["dev1"].contains(auto.ID) || !strings.Contains(auto.Result, resp.ID) {
+		t.Fatalf("displaced task is %s (%q), want cancelled naming the critical task", auto.Status, auto.Result)
+	}
+	if len(resp.Preempted) != 1 || resp.Preempted[0].TaskID != auto.ID || resp.Preempted[0].Outcome != "cancelled" || len(resp.Preempted[0].Placements) != 0 {
+		t.Fatalf("preempted %+v, want the auto task cancelled without placements", resp.Preempted)
+	}
+	if len(auto.Preemptions) != 1 || auto.Preemptions[0].Outcome != "cancelled" {
+		t.Fatalf("preemption history of the displaced task is %+v", auto.Preemptions)
+	}
+}
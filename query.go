@@ -0,0 +1,190 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// taskQuery filters, orders and pages tasks for GET /tasks and GET /schedule
+type taskQuery struct {
+	Zones    []string
+	From     time.Time // tasks ending after From
+	To       time.Time // tasks starting before To
+	Statuses []string
+	Type     string
+	Critical *bool
+	Owner    string
+	Labels   []string // tasks should have all of them
+	Sort     string   // start, end, deadline, priority, name or id; descending with "-" prefix
+	Limit    int      // no limit if 0
+	Offset   int
+}
+
+// taskQueryParams are query parameters of taskQuery; GET /tasks without them returns the map of all tasks
+var taskQueryParams = []string{"zone", "from", "to", "status", "type", "critical", "owner", "label", "sort", "limit", "offset"}
+
+var taskSortKeys = map[string]func(a *Task, b *Task) bool{
+	"start": func(a *Task, b *Task) bool { return a.StartDatetime.Before(b.StartDatetime) },
+	"end": func(a *Task, b *Task) bool {
+		return a.StartDatetime.Add(a.Duration).Before(b.StartDatetime.Add(b.Duration))
+	},
+	"deadline": func(a *Task, b *Task) bool { return a.Deadline.Before(b.Deadline) },
+	"priority": func(a *Task, b *Task) bool { return a.Priority < b.Priority },
+	"name":     func(a *Task, b *Task) bool { return a.Name < b.Name },
+	"id":       func(a *Task, b *Task) bool { return a.ID < b.ID },
+}
+
+func hasTaskQuery(r *http.Request) bool {
+	query := r.URL.Query()
+	for _, param := range taskQueryParams {
+		if _, ok := query[param]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseQueryTime parses a time like in requests or a duration relative to now, e.g. "24h" or "-1h"
+func parseQueryTime(value string, loc *time.Location) (time.Time, error) {
+	if offset, err := time.ParseDuration(value); err == nil {
+		return clock.Now().Add(offset), nil
+	}
+	return parseDatetime(value, loc)
+}
+
+func splitParam(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func taskQueryFromRequest(r *http.Request) (taskQuery, error) {
+	query := r.URL.Query()
+	taskQuery := taskQuery{
+		Zones:    splitParam(query.Get("zone")),
+		Statuses: splitParam(query.Get("status")),
+		Type:     query.Get("type"),
+		Owner:    query.Get("owner"),
+		Labels:   query["label"],
+		Sort:     query.Get("sort"),
+	}
+	var err error
+	if from := query.Get("from"); from != "" {
+		taskQuery.From, err = parseQueryTime(from, requestLocation(r))
+		if err != nil {
+			return taskQuery, newAPIError(codeInvalidRequest, "invalid from: %s", from)
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		taskQuery.To, err = parseQueryTime(to, requestLocation(r))
+		if err != nil {
+			return taskQuery, newAPIError(codeInvalidRequest, "invalid to: %s", to)
+		}
+	}
+	if critical := query.Get("critical"); critical != "" {
+		isCritical, err := strconv.ParseBool(critical)
+		if err != nil {
+			return taskQuery, newAPIError(codeInvalidRequest, "invalid critical: %s", critical)
+		}
+		taskQuery.Critical = &isCritical
+	}
+	if _, ok := taskSortKeys[strings.TrimPrefix(taskQuery.Sort, "-")]; taskQuery.Sort != "" && !ok {
+		return taskQuery, newAPIError(codeInvalidRequest, "invalid sort: %s", taskQuery.Sort)
+	}
+	if limit := query.Get("limit"); limit != "" {
+		taskQuery.Limit, err = strconv.Atoi(limit)
+		if err != nil || taskQuery.Limit < 0 {
+			return taskQuery, newAPIError(codeInvalidRequest, "invalid limit: %s", limit)
+		}
+	}
+	if offset := query.Get("offset"); offset != "" {
+		taskQuery.Offset, err = strconv.Atoi(offset)
+		if err != nil || taskQuery.Offset < 0 {
+			return taskQuery, newAPIError(codeInvalidRequest, "invalid offset: %s", offset)
+		}
+	}
+	return taskQuery, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (q taskQuery) matches(task *Task) bool {
+	if len(q.Zones) > 0 {
+		inZone := false
+		for _, zone := range task.Zones {
+			inZone = inZone || containsString(q.Zones, zone)
+		}
+		if !inZone {
+			return false
+		}
+	}
+	if !q.From.IsZero() && !task.StartDatetime.Add(task.Duration).After(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !task.StartDatetime.Before(q.To) {
+		return false
+	}
+	if len(q.Statuses) > 0 && !containsString(q.Statuses, task.Status) {
+		return false
+	}
+	if q.Type != "" && task.Type != q.Type {
+		return false
+	}
+	if q.Critical != nil && task.Critical != *q.Critical {
+		return false
+	}
+	if q.Owner != "" && task.Owner != q.Owner {
+		return false
+	}
+	for _, label := range q.Labels {
+		if !containsString(task.Labels, label) {
+			return false
+		}
+	}
+	return true
+}
+
+// apply filters, sorts (by start by default, ties by ID) and pages the tasks; total is the number of matching tasks
+func (q taskQuery) apply(candidates []*Task) (page []*Task, total int) {
+	matching := []*Task{}
+	for _, task := range candidates {
+		if q.matches(task) {
+			matching = append(matching, task)
+		}
+	}
+	sortKey := strings.TrimPrefix(q.Sort, "-")
+	if sortKey == "" {
+		sortKey = "start"
+	}
+	less := taskSortKeys[sortKey]
+	descending := strings.HasPrefix(q.Sort, "-")
+	sort.SliceStable(matching, func(i, j int) bool {
+		switch {
+		case less(matching[i], matching[j]):
+			return !descending
+		case less(matching[j], matching[i]):
+			return descending
+		}
+		return matching[i].ID < matching[j].ID
+	})
+	total = len(matching)
+	if q.Offset >= total {
+		return []*Task{}, total
+	}
+	matching = matching[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(matching) {
+		matching = matching[:q.Limit]
+	}
+	return matching, total
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// setupQueryTasks places four tasks; by start they are d, a, b, c
+func setupQueryTasks(t *testing.T) {
+	t.Helper()
+	setupState(t, "dev1", "dev2")
+	a := newTestTask("a", "auto", testStart.Add(time.Hour), 30*time.Minute, "dev1")
+	a.Owner, a.Labels = "alice", []string{"db"}
+	b := newTestTask("b", "manual", testStart.Add(2*time.Hour), time.Hour, "dev2")
+	b.Critical, b.Priority, b.Owner, b.Labels = true, 0, "bob", []string{"db", "net"}
+	c := newTestTask("c", "auto", testStart.Add(3*time.Hour), time.Hour, "dev1")
+	c.Status, c.Owner, c.Labels = "complete", "alice", []string{"net"}
+	d := newTestTask("d", "manual", testStart.Add(30*time.Minute), 2*time.Hour, "dev1", "dev2")
+	for _, task := range []*Task{a, b, c, d} {
+		placeTestTask(task)
+	}
+}
+
+func TestListTasksQuery(t *testing.T) {
+	setupQueryTasks(t)
+	cases := []struct {
+		query string
+		want  []string
+		total int
+	}{
+		{query: "zone=dev2", want: []string{"d", "b"}, total: 2},
+		{query: "zone=dev1,dev2", want: []string{"d", "a", "b", "c"}, total: 4},
+		{query: "from=2h", want: []string{"d", "b", "c"}, total: 3},
+		{query: "to=2h", want: []string{"d", "a"}, total: 2},
+		{query: "from=1h30m&to=3h", want: []string{"d", "b"}, total: 2},
+		{query: "from=07/01/2030+03:30", want: []string{"c"}, total: 1},
+		{query: "status=complete", want: []string{"c"}, total: 1},
+		{query: "status=wait,complete&type=auto", want: []string{"a", "c"}, total: 2},
+		{query: "critical=true", want: []string{"b"}, total: 1},
+		{query: "critical=false&type=manual", want: []string{"d"}, total: 1},
+		{query: "owner=alice", want: []string{"a", "c"}, total: 2},
+		{query: "label=db&label=net", want: []string{"b"}, total: 1},
+		{query: "sort=-start", want: []string{"c", "b", "a", "d"}, total: 4},
+		{query: "sort=end", want: []string{"a", "d", "b", "c"}, total: 4},
+		{query: "sort=deadline", want: []string{"d", "a", "b", "c"}, total: 4},
+		// ties are ordered by ID in both directions
+		{query: "sort=priority", want: []string{"b", "d", "a", "c"}, total: 4},
+		{query: "sort=-priority", want: []string{"a", "c", "d", "b"}, total: 4},
+		{query: "sort=name&limit=2", want: []string{"a", "b"}, total: 4},
+		{query: "sort=id&offset=3", want: []string{"d"}, total: 4},
+		{query: "limit=2&offset=1", want: []string{"a", "b"}, total: 4},
+		{query: "owner=alice&limit=1&offset=1", want: []string{"c"}, total: 2},
+		{query: "offset=10", want: []string{}, total: 4},
+		{query: "limit=0", want: []string{"d", "a", "b", "c"}, total: 4},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			listTasks(w, httptest.NewRequest("GET", "/tasks?"+c.query, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("returned %d %s", w.Code, w.Body.String())
+			}
+			var page struct {
+				Total int
+				Tasks []struct{ ID string }
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, task := range page.Tasks {
+				got = append(got, task.ID)
+			}
+			if !reflect.DeepEqual(got, c.want) || page.Total != c.total {
+				t.Fatalf("returned %v of %d, want %v of %d", got, page.Total, c.want, c.total)
+			}
+		})
+	}
+}
+
+func TestListTasksInvalidQuery(t *testing.T) {
+	setupQueryTasks(t)
+	for _, query := range []string{"sort=size", "sort=--start", "limit=-1", "limit=ten", "offset=-1", "offset=x", "critical=maybe", "from=yesterday", "to=32/01/2030+00:00"} {
+		w := httptest.NewRecorder()
+		listTasks(w, httptest.NewRequest("GET", "/tasks?"+query, nil))
+		var apiErr APIError
+		json.Unmarshal(w.Body.Bytes(), &apiErr)
+		if w.Code != http.StatusBadRequest || apiErr.Code != codeInvalidRequest {
+			t.Errorf("%s returned %d %s, want %s", query, w.Code, w.Body.String(), codeInvalidRequest)
+		}
+	}
+}
+
+func TestListTasksWithoutQuery(t *testing.T) {
+	setupQueryTasks(t)
+	w := httptest.NewRecorder()
+	listTasks(w, httptest.NewRequest("GET", "/tasks", nil))
+	var all map[string]*Task
+	if err := json.Unmarshal(w.Body.Bytes(), &all); err != nil {
+		t.Fatalf("returned %s, want the map of all tasks: %v", w.Body.String(), err)
+	}
+	if len(all) != 4 {
+		t.Fatalf("returned %d tasks, want 4", len(all))
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recurrence produces occurrence start times of a series
+type recurrence interface {
+	between(from time.Time, to time.Time) []time.Time
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func sortedKeys(values map[int]bool) []int {
+	keys := []int{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// cronSchedule is a standard 5-field cron expression: minute hour day-of-month month day-of-week
+type cronSchedule struct {
+	minutes    map[int]bool
+	hours      map[int]bool
+	days       map[int]bool
+	months     map[int]bool
+	weekdays   map[int]bool
+	anyDay     bool
+	anyWeekday bool
+}
+
+func parseCronField(field string, min int, max int) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step in %s", field)
+			}
+			part = part[:i]
+		}
+		low, high := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var errLow, errHigh error
+			low, errLow = strconv.Atoi(bounds[0])
+			high, errHigh = strconv.Atoi(bounds[1])
+			if errLow != nil || errHigh != nil {
+				return nil, fmt.Errorf("invalid range in %s", field)
+			}
+		default:
+			value, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value in %s", field)
+			}
+			low, high = value, value
+			if step > 1 {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return nil, fmt.Errorf("%s is out of range %d-%d", field, min, max)
+		}
+		for value := low; value <= high; value += step {
+			values[value] = true
+		}
+	}
+	return values, nil
+}
+
+func parseCron(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron should have 5 fields (minute hour day month weekday), got %d", len(fields))
+	}
+	bounds := [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	sets := make([]map[int]bool, len(fields))
+	for i, field := range fields {
+		set, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron %q: %w", spec, err)
+		}
+		sets[i] = set
+	}
+	if sets[4][7] { // both 0 and 7 are Sunday
+		sets[4][0] = true
+	}
+	return &cronSchedule{
+		minutes:    sets[0],
+		hours:      sets[1],
+		days:       sets[2],
+		months:     sets[3],
+		weekdays:   sets[4],
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}, nil
+}
+
+// matchesDay follows cron rules: if both day of month and day of week are restricted, either matches
+func (c *cronSchedule) matchesDay(day time.Time) bool {
+	if !c.months[int(day.Month())] {
+		return false
+	}
+	dayMatches := c.days[day.Day()]
+	weekdayMatches := c.weekdays[int(day.Weekday())]
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekdayMatches
+	case c.anyWeekday:
+		return dayMatches
+	}
+	return dayMatches || weekdayMatches
+}
+
+func (c *cronSchedule) between(from time.Time, to time.Time) []time.Time {
+	times := []time.Time{}
+	for day := startOfDay(from); !day.After(to); day = day.AddDate(0, 0, 1) {
+		if !c.matchesDay(day) {
+			continue
+		}
+		for _, hour := range sortedKeys(c.hours) {
+			for _, minute := range sortedKeys(c.minutes) {
+				t := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location())
+				if t.Before(from) || t.After(to) {
+					continue
+				}
+				times = append(times, t)
+			}
+		}
+	}
+	return times
+}
+
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// rrule is a subset of RFC 5545 recurrence rules: FREQ (DAILY, WEEKLY, MONTHLY), INTERVAL, BYDAY (without ordinals),
+// BYMONTHDAY, BYHOUR, BYMINUTE, COUNT and UNTIL; the series start is DTSTART
+type rrule struct {
+	freq       string
+	interval   int
+	byDay      map[time.Weekday]bool
+	byMonthDay map[int]bool
+	byHour     []int
+	byMinute   []int
+	count      int
+	until      time.Time
+	dtStart    time.Time
+}
+
+func parseRuleInts(value string, min int, max int) ([]int, error) {
+	ints := []int{}
+	for _, part := range strings.Split(value, ",") {
+		i, err := strconv.Atoi(part)
+		if err != nil || i < min || i > max {
+			return nil, fmt.Errorf("invalid value %s", part)
+		}
+		ints = append(ints, i)
+	}
+	sort.Ints(ints)
+	return ints, nil
+}
+
+func parseRRule(spec string, dtStart time.Time) (*rrule, error) {
+	rule := &rrule{interval: 1, byDay: make(map[time.Weekday]bool), byMonthDay: make(map[int]bool), dtStart: dtStart}
+	for _, part := range strings.Split(strings.TrimPrefix(spec, "RRULE:"), ";") {
+		keyValue := strings.SplitN(part, "=", 2)
+		if len(keyValue) != 2 {
+			return nil, fmt.Errorf("invalid rrule part %q", part)
+		}
+		key, value := keyValue[0], keyValue[1]
+		var err error
+		switch key {
+		case "FREQ":
+			if value != "DAILY" && value != "WEEKLY" && value != "MONTHLY" {
+				return nil, fmt.Errorf("unsupported rrule FREQ %s", value)
+			}
+			rule.freq = value
+		case "INTERVAL":
+			rule.interval, err = strconv.Atoi(value)
+			if err == nil && rule.interval <= 0 {
+				err = fmt.Errorf("should be positive")
+			}
+		case "COUNT":
+			rule.count, err = strconv.Atoi(value)
+			if err == nil && rule.count <= 0 {
+				err = fmt.Errorf("should be positive")
+			}
+		case "UNTIL":
+			rule.until, err = time.Parse("20060102T150405Z", value)
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := rruleWeekdays[day]
+				if !ok {
+					return nil, fmt.Errorf("unsupported rrule BYDAY %s", day)
+				}
+				rule.byDay[weekday] = true
+			}
+		case "BYMONTHDAY":
+			var days []int
+			days, err = parseRuleInts(value, 1, 31)
+			for _, day := range days {
+				rule.byMonthDay[day] = true
+			}
+		case "BYHOUR":
+			rule.byHour, err = parseRuleInts(value, 0, 23)
+		case "BYMINUTE":
+			rule.byMinute, err = parseRuleInts(value, 0, 59)
+		default:
+			return nil, fmt.Errorf("unsupported rrule part %s", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid rrule %s: %w", key, err)
+		}
+	}
+	if rule.freq == "" {
+		return nil, fmt.Errorf("rrule should have FREQ")
+	}
+	if len(rule.byHour) == 0 {
+		rule.byHour = []int{dtStart.Hour()}
+	}
+	if len(rule.byMinute) == 0 {
+		rule.byMinute = []int{dtStart.Minute()}
+	}
+	if rule.freq == "WEEKLY" && len(rule.byDay) == 0 {
+		rule.byDay[dtStart.Weekday()] = true
+	}
+	if rule.freq == "MONTHLY" && len(rule.byDay) == 0 && len(rule.byMonthDay) == 0 {
+		rule.byMonthDay[dtStart.Day()] = true
+	}
+	return rule, nil
+}
+
+// inPeriod tells if the day is in a period selected by INTERVAL counting from DTSTART
+func (r *rrule) inPeriod(day time.Time) bool {
+	start := startOfDay(r.dtStart)
+	switch r.freq {
+	case "DAILY":
+		return int(day.Sub(start).Hours()+12)/24%r.interval == 0
+	case "WEEKLY":
+		weekStart := start.AddDate(0, 0, -(int(start.Weekday())+6)%7) // weeks start on Monday
+		return int(day.Sub(weekStart).Hours()+12)/24/7%r.interval == 0
+	}
+	months := (day.Year()-start.Year())*12 + int(day.Month()) - int(start.Month())
+	return months%r.interval == 0
+}
+
+func (r *rrule) matchesDay(day time.Time) bool {
+	if len(r.byDay) > 0 && !r.byDay[day.Weekday()] {
+		return false
+	}
+	if len(r.byMonthDay) > 0 && !r.byMonthDay[day.Day()] {
+		return false
+	}
+	return true
+}
+
+func (r *rrule) between(from time.Time, to time.Time) []time.Time {
+	times := []time.Time{}
+	counted := 0
+	for day := startOfDay(r.dtStart); !day.After(to); day = day.AddDate(0, 0, 1) {
+		if !r.inPeriod(day) || !r.matchesDay(day) {
+			continue
+		}
+		for _, hour := range r.byHour {
+			for _, minute := range r.byMinute {
+				t := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location())
+				if t.Before(r.dtStart) {
+					continue
+				}
+				if t.After(to) || (!r.until.IsZero() && t.After(r.until)) {
+					return times
+				}
+				counted++ // COUNT includes occurrences before from
+				if r.count > 0 && counted > r.count {
+					return times
+				}
+				if !t.Before(from) {
+					times = append(times, t)
+				}
+			}
+		}
+	}
+	return times
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// formatTimes renders times in UTC for comparing occurrences
+func formatTimes(times []time.Time) []string {
+	formatted := []string{}
+	for _, t := range times {
+		formatted = append(formatted, t.UTC().Format("2006-01-02 15:04"))
+	}
+	return formatted
+}
+
+func mustParseTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse("2006-01-02 15:04", value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestParseCron(t *testing.T) {
+	// 2030-01-07 is a Monday
+	cases := []struct {
+		spec string
+		from string
+		to   string
+		want []string
+		err  bool
+	}{
+		{spec: "0 3 * * *", from: "2030-01-07 00:00", to: "2030-01-08 23:59", want: []string{"2030-01-07 03:00", "2030-01-08 03:00"}},
+		{spec: "*/15 9 * * *", from: "2030-01-07 09:10", to: "2030-01-07 10:00", want: []string{"2030-01-07 09:15", "2030-01-07 09:30", "2030-01-07 09:45"}},
+		{spec: "0 8-10/2 * * *", from: "2030-01-07 00:00", to: "2030-01-07 23:59", want: []string{"2030-01-07 08:00", "2030-01-07 10:00"}},
+		{spec: "30 22 * * 1-5", from: "2030-01-09 00:00", to: "2030-01-13 23:59", want: []string{"2030-01-09 22:30", "2030-01-10 22:30", "2030-01-11 22:30"}},
+		{spec: "0 12 * * 7", from: "2030-01-07 00:00", to: "2030-01-20 23:59", want: []string{"2030-01-13 12:00", "2030-01-20 12:00"}},
+		{spec: "0 0 1,15 * *", from: "2030-01-01 00:00", to: "2030-02-01 00:00", want: []string{"2030-01-01 00:00", "2030-01-15 00:00", "2030-02-01 00:00"}},
+		{spec: "0 0 * 2 *", from: "2030-01-30 00:00", to: "2030-02-02 00:00", want: []string{"2030-02-01 00:00", "2030-02-02 00:00"}},
+		// either restricted day of month or day of week matches
+		{spec: "0 0 13 * 5", from: "2030-01-07 00:00", to: "2030-01-19 00:00", want: []string{"2030-01-11 00:00", "2030-01-13 00:00", "2030-01-18 00:00"}},
+		{spec: "0 0 31 2 *", from: "2030-01-01 00:00", to: "2030-12-31 00:00", want: []string{}},
+		{spec: "* * * *", err: true},
+		{spec: "0 0 * * * *", err: true},
+		{spec: "60 * * * *", err: true},
+		{spec: "0 24 * * *", err: true},
+		{spec: "0 0 0 * *", err: true},
+		{spec: "0 0 * 13 *", err: true},
+		{spec: "0 0 * * 8", err: true},
+		{spec: "*/0 * * * *", err: true},
+		{spec: "5-1 * * * *", err: true},
+		{spec: "a * * * *", err: true},
+		{spec: "1-x * * * *", err: true},
+	}
+	for _, c := range cases {
+		t.Run(c.spec, func(t *testing.T) {
+			cron, err := parseCron(c.spec)
+			if c.err {
+				if err == nil {
+					t.Fatalf("parsed %q, want an error", c.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := formatTimes(cron.between(mustParseTime(t, c.from), mustParseTime(t, c.to)))
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("occurrences are %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseRRule(t *testing.T) {
+	// 2030-01-07 is a Monday
+	cases := []struct {
+		spec    string
+		dtStart string
+		from    string
+		to      string
+		want    []string
+		err     bool
+	}{
+		{spec: "FREQ=DAILY", dtStart: "2030-01-07 02:30", from: "2030-01-07 00:00", to: "2030-01-09 23:59", want: []string{"2030-01-07 02:30", "2030-01-08 02:30", "2030-01-09 02:30"}},
+		{spec: "FREQ=DAILY", dtStart: "2030-01-07 02:30", from: "2030-01-06 00:00", to: "2030-01-07 02:29", want: []string{}},
+		{spec: "RRULE:FREQ=DAILY;INTERVAL=2", dtStart: "2030-01-07 02:30", from: "2030-01-08 00:00", to: "2030-01-12 23:59", want: []string{"2030-01-09 02:30", "2030-01-11 02:30"}},
+		{spec: "FREQ=WEEKLY", dtStart: "2030-01-09 10:00", from: "2030-01-07 00:00", to: "2030-01-20 23:59", want: []string{"2030-01-09 10:00", "2030-01-16 10:00"}},
+		{spec: "FREQ=WEEKLY;BYDAY=MO,WE,FR", dtStart: "2030-01-07 10:00", from: "2030-01-07 00:00", to: "2030-01-13 23:59", want: []string{"2030-01-07 10:00", "2030-01-09 10:00", "2030-01-11 10:00"}},
+		// weeks start on Monday, so the Sunday after DTSTART is in the first week
+		{spec: "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,SU", dtStart: "2030-01-07 10:00", from: "2030-01-07 00:00", to: "2030-02-03 23:59", want: []string{"2030-01-08 10:00", "2030-01-13 10:00", "2030-01-22 10:00", "2030-01-27 10:00"}},
+		{spec: "FREQ=MONTHLY", dtStart: "2030-01-07 06:00", from: "2030-01-01 00:00", to: "2030-03-31 00:00", want: []string{"2030-01-07 06:00", "2030-02-07 06:00", "2030-03-07 06:00"}},
+		{spec: "FREQ=MONTHLY;BYMONTHDAY=1,15", dtStart: "2030-01-07 06:00", from: "2030-01-01 00:00", to: "2030-03-01 06:00", want: []string{"2030-01-15 06:00", "2030-02-01 06:00", "2030-02-15 06:00", "2030-03-01 06:00"}},
+		{spec: "FREQ=MONTHLY;INTERVAL=3;BYMONTHDAY=31", dtStart: "2030-01-07 06:00", from: "2030-01-01 00:00", to: "2030-12-31 23:59", want: []string{"2030-01-31 06:00", "2030-07-31 06:00", "2030-10-31 06:00"}},
+		{spec: "FREQ=MONTHLY;BYDAY=SA;BYMONTHDAY=13,14,15,16,17,18,19", dtStart: "2030-01-07 06:00", from: "2030-01-01 00:00", to: "2030-02-28 00:00", want: []string{"2030-01-19 06:00", "2030-02-16 06:00"}},
+		// COUNT includes occurrences before from
+		{spec: "FREQ=DAILY;COUNT=3", dtStart: "2030-01-07 02:30", from: "2030-01-08 00:00", to: "2030-01-31 00:00", want: []string{"2030-01-08 02:30", "2030-01-09 02:30"}},
+		{spec: "FREQ=DAILY;UNTIL=20300109T060000Z;BYHOUR=6,18;BYMINUTE=0,30", dtStart: "2030-01-08 00:00", from: "2030-01-01 00:00", to: "2030-01-31 00:00", want: []string{"2030-01-08 06:00", "2030-01-08 06:30", "2030-01-08 18:00", "2030-01-08 18:30", "2030-01-09 06:00"}},
+		{spec: "FREQ=YEARLY", err: true},
+		{spec: "FREQ=HOURLY", err: true},
+		{spec: "FREQ=SECONDLY;INTERVAL=10", err: true},
+		{spec: "INTERVAL=2", err: true},
+		{spec: "FREQ", err: true},
+		{spec: "FREQ=DAILY;INTERVAL=0", err: true},
+		{spec: "FREQ=DAILY;COUNT=-1", err: true},
+		{spec: "FREQ=DAILY;UNTIL=2030-01-09", err: true},
+		{spec: "FREQ=WEEKLY;BYDAY=1MO", err: true},
+		{spec: "FREQ=MONTHLY;BYMONTHDAY=-1", err: true},
+		{spec: "FREQ=DAILY;BYHOUR=24", err: true},
+		{spec: "FREQ=DAILY;BYSETPOS=1", err: true},
+	}
+	for _, c := range cases {
+		t.Run(c.spec, func(t *testing.T) {
+			rule, err := parseRRule(c.spec, testStart)
+			if c.err {
+				if err == nil {
+					t.Fatalf("parsed %q, want an error", c.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			rule, err = parseRRule(c.spec, mustParseTime(t, c.dtStart))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := formatTimes(rule.between(mustParseTime(t, c.from), mustParseTime(t, c.to)))
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("occurrences are %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestSeriesOccurrenceLimit(t *testing.T) {
+	setupState(t, "dev1")
+	cases := []struct {
+		cron  string
+		limit int
+		err   bool
+	}{
+		{cron: "* * * * *", err: true}, // about 43000 occurrences in 30 days
+		{cron: "0 * * * *"},            // 720 occurrences
+		{cron: "0 * * * *", limit: 500, err: true},
+		{cron: "0 3 * * *", limit: 500},
+	}
+	for _, c := range cases {
+		config.MaxSeriesOccurrences = c.limit
+		_, err := seriesFromReq(SeriesReq{Name: "s", Cron: c.cron, Duration: "10m", Zones: []string{"dev1"}, Type: "auto"}, time.UTC)
+		if c.err && asAPIError(err, codeInternal).Code != codeInvalidRequest {
+			t.Errorf("series %q with limit %d returned %v, want %s", c.cron, c.limit, err, codeInvalidRequest)
+		}
+		if !c.err && err != nil {
+			t.Errorf("series %q with limit %d returned %v", c.cron, c.limit, err)
+		}
+	}
+
+	// series added before the limit was lowered expand only up to it
+	config.MaxSeriesOccurrences = 0
+	s, err := seriesFromReq(SeriesReq{Name: "s", Cron: "0 * * * *", Duration: "10m", Zones: []string{"dev1"}, Type: "auto"}, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ID, s.Overrides, s.Occurrences = "s", make(map[string]Override), make(map[string]string)
+	recurringSeries[s.ID] = &s
+	config.MaxSeriesOccurrences = 100
+	expandSeries(&s, clock.Now())
+	if len(s.Occurrences) != 100 {
+		t.Fatalf("expanded %d occurrences, want 100", len(s.Occurrences))
+	}
+}
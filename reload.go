@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"go.uber.org/multierr"
+)
+
+// ReloadReport tells what rescheduling on a config reload did to the scheduled tasks
+type ReloadReport struct {
+	ID         string
+	Datetime   time.Time
+	ConfigFile string
+	Kept       []TaskChange         // tasks that kept their slot
+	Moved      []TaskChange         // tasks moved to another slot, or per-zone tasks split from them
+	Compressed []TaskChange         // per-zone tasks split from tasks with compression
+	Cancelled  []TaskChange         // tasks that lost their slot; split tasks are listed by their per-zone tasks
+	Errors     map[string]*APIError `json:",omitempty"` // why tasks that couldn't be re-placed were cancelled, by task ID
+}
+
+// maxReloadReports is how many of the latest reports are kept
+const maxReloadReports = 50
+
+var reloadReports = make(map[string]*ReloadReport)
+
+// newReloadReport compares the schedule after rescheduling with the snapshot taken before it
+func newReloadReport(before stateSnapshot, configFile string, failed map[string]error) *ReloadReport {
+	changes := diffState(before)
+	report := &ReloadReport{
+		ID:         uuid.New().String(),
+		Datetime:   clock.Now(),
+		ConfigFile: configFile,
+		Kept:       []TaskChange{},
+		Moved:      append([]TaskChange{}, changes.Displaced...),
+		Compressed: append([]TaskChange{}, changes.Compressed...),
+		Cancelled:  []TaskChange{},
+		Errors:     make(map[string]*APIError, len(failed)),
+	}
+	for _, change := range changes.Cancelled {
+		if change.Status != "split" {
+			report.Cancelled = append(report.Cancelled, change)
+		}
+	}
+	scheduledBefore, scheduledAfter := scheduledTaskIds(before.schedule), scheduledTaskIds(schedule)
+	taskIDs := []string{}
+	for taskID := range scheduledBefore {
+		taskIDs = append(taskIDs, taskID)
+	}
+	sort.Strings(taskIDs)
+	for _, taskID := range taskIDs {
+		oldTask, task := before.tasks[taskID], tasks[taskID]
+		if task == nil || !scheduledAfter[taskID] || !oldTask.StartDatetime.Equal(task.StartDatetime) || oldTask.Duration != task.Duration {
+			continue
+		}
+		change := newTaskChange(*task)
+		change.setOld(oldTask)
+		change.setNew(*task)
+		report.Kept = append(report.Kept, change)
+	}
+	for taskID, err := range failed {
+		report.Errors[taskID] = asAPIError(err, codeInternal)
+	}
+	return report
+}
+
+// recordReloadReport stores the report, dropping the oldest ones over maxReloadReports
+func recordReloadReport(report *ReloadReport) {
+	reloadReports[report.ID] = report
+	reports := allReloadReports()
+	if len(reports) <= maxReloadReports {
+		return
+	}
+	for _, old := range reports[maxReloadReports:] {
+		delete(reloadReports, old.ID)
+	}
+}
+
+// allReloadReports lists reports from the latest
+func allReloadReports() []*ReloadReport {
+	reports := []*ReloadReport{}
+	for _, report := range reloadReports {
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if !reports[i].Datetime.Equal(reports[j].Datetime) {
+			return reports[i].Datetime.After(reports[j].Datetime)
+		}
+		return reports[i].ID < reports[j].ID
+	})
+	return reports
+}
+
+// rescheduleWithReport re-places tasks after a config reload and records what happened to them
+func rescheduleWithReport(configFile string) *ReloadReport {
+	before := snapshotState()
+	failed := reschedule()
+	taskIDs := []string{}
+	for taskID := range failed {
+		taskIDs = append(taskIDs, taskID)
+	}
+	sort.Strings(taskIDs)
+	var errors error
+	for _, taskID := range taskIDs {
+		errors = multierr.Append(errors, fmt.Errorf("%s: %w", taskID, failed[taskID]))
+	}
+	if errors != nil {
+		log.Warn(fmt.Sprintf("Rescheduling errors: %s", errors.Error()))
+	}
+	report := newReloadReport(before, configFile, failed)
+	recordReloadReport(report)
+	return report
+}
+
+// notifyReload posts the report to the webhooks from config; failures are only logged
+func notifyReload(report *ReloadReport, webhooks []string) {
+	if len(webhooks) == 0 {
+		return
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, webhook := range webhooks {
+		go func(webhook string) {
+			resp, err := client.Post(webhook, "application/json", bytes.NewReader(body))
+			if err != nil {
+				log.Warn(fmt.Sprintf("Reload report %s not sent to %s: %s", report.ID, webhook, err.Error()))
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				log.Warn(fmt.Sprintf("Reload report %s not accepted by %s: %s", report.ID, webhook, resp.Status))
+				return
+			}
+			log.Debug("Sent reload report ", report.ID, " to ", webhook)
+		}(webhook)
+	}
+}
+
+func listReloadReports(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	var resp []byte
+	var err error
+	engine.View(func() {
+		resp, err = json.Marshal(inRequestLocation(r, allReloadReports()))
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		log.Error(err)
+		return
+	}
+	w.Write(resp)
+}
+
+func getReloadReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	reportID := mux.Vars(r)["uuid"]
+	var resp []byte
+	var err error
+	ok := false
+	engine.View(func() {
+		var report *ReloadReport
+		report, ok = reloadReports[reportID]
+		if ok {
+			resp, err = json.Marshal(inRequestLocation(r, report))
+		}
+	})
+	if !ok {
+		writeError(w, http.StatusBadRequest, newAPIError(codeReportNotFound, "No reload report with this ID %s", reportID))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		log.Error(err)
+		return
+	}
+	w.Write(resp)
+}
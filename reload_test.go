@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// reportedIDs lists task IDs of report entries, with names for per-zone tasks split from other tasks
+func reportedIDs(changes []TaskChange) []string {
+	ids := []string{}
+	for _, change := range changes {
+		if task, ok := tasks[change.TaskID]; ok && task.ParentID != "" {
+			ids = append(ids, task.ParentID+"@"+task.Zones[0])
+			continue
+		}
+		ids = append(ids, change.TaskID)
+	}
+	return ids
+}
+
+func TestReloadReport(t *testing.T) {
+	setupState(t, "dev1", "dev2")
+	kept := newTestTask("kept", "auto", testStart.Add(30*time.Minute), 30*time.Minute, "dev1")
+	// moved out of a freeze added by the reload
+	frozen := newTestTask("frozen", "auto", testStart.Add(10*time.Hour), time.Hour, "dev1")
+	// outside of the whitelist of dev2 after the reload
+	outside := newTestTask("outside", "manual", testStart.Add(20*time.Hour), time.Hour, "dev2")
+	// displaced by the manual task once the pause after it is longer; the manual task is placed
+	// after its dependency, which is placed after the compressed task
+	compressed := newTestTask("compressed", "auto", testStart.Add(3*time.Hour), time.Hour, "dev1", "dev2")
+	compressed.CompressionPerc = 50
+	dependency := newTestTask("dependency", "auto", testStart.Add(time.Hour), 30*time.Minute, "dev2")
+	dependency.CreatedAt = testStart.Add(time.Minute)
+	manual := newTestTask("manual", "manual", testStart.Add(4*time.Hour+5*time.Minute), time.Hour, "dev1")
+	manual.Dependencies = []Dependency{{TaskID: dependency.ID}}
+	for _, task := range []*Task{kept, frozen, outside, compressed, dependency, manual} {
+		placeTestTask(task)
+	}
+
+	config.WhiteListRaw["dev2"] = []string{"00:00-12:00"}
+	config.Pauses["dev1"] = 30 * time.Minute
+	config.FreezesRaw = []FreezeConfig{{Name: "release", Zones: []string{"dev1"}, Start: "07/01/2030 09:00", End: "07/01/2030 12:00"}}
+	if err := loadWhiteList(); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadFreezes(); err != nil {
+		t.Fatal(err)
+	}
+	report := rescheduleWithReport("config.yaml")
+
+	expect := func(name string, changes []TaskChange, want ...string) {
+		t.Helper()
+		got := reportedIDs(changes)
+		if len(got) != len(want) {
+			t.Fatalf("%s tasks are %v, want %v", name, got, want)
+		}
+		for _, id := range want {
+			if !containsString(got, id) {
+				t.Fatalf("%s tasks are %v, want %v", name, got, want)
+			}
+		}
+	}
+	expect("kept", report.Kept, "kept", "dependency", "manual")
+	expect("moved", report.Moved, "frozen")
+	expect("compressed", report.Compressed, "compressed@dev1", "compressed@dev2")
+	expect("cancelled", report.Cancelled, "outside")
+
+	if moved := report.Moved[0]; !moved.OldStartDatetime.Equal(frozen.PreferredStartDatetime) || !moved.NewStartDatetime.Equal(testStart.Add(12*time.Hour)) {
+		t.Errorf("frozen task moved from %v to %v, want from %v to the end of the freeze", moved.OldStartDatetime, moved.NewStartDatetime, frozen.PreferredStartDatetime)
+	}
+	for _, change := range report.Compressed {
+		if end := change.NewEndDatetime.Sub(*change.NewStartDatetime); end != 30*time.Minute {
+			t.Errorf("per-zone task %s takes %v, want 30m", change.TaskID, end)
+		}
+	}
+	if err, ok := report.Errors["outside"]; !ok || err.Code != codeOutsideWhitelist {
+		t.Errorf("errors are %v, want %s for the cancelled task", report.Errors, codeOutsideWhitelist)
+	}
+	if reloadReports[report.ID] != report {
+		t.Error("report isn't recorded")
+	}
+}
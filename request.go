@@ -1,5 +1,10 @@
 package main
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type AddTaskReq struct {
 	Name					string	 `json:"Name"`
 	StartDatetime 			string   `json:"StartDatetime"`
@@ -10,6 +15,56 @@ type AddTaskReq struct {
 	Type 					string   `json:"Type"` // auto or manual
 	Critical 				bool     `json:"Critical"` // only for manual type
 	CompressionPerc			int 	 `json:"CompressionPerc,omitempty"`  // compression percentage for auto
+	Dependencies			[]DependencyReq `json:"Dependencies,omitempty"`  // tasks that should end before this one starts
+	Rollout					bool	 `json:"Rollout,omitempty"`  // run zones one after another in the listed order
+	Soak					string	 `json:"Soak,omitempty"`  // pause between rollout stages, rolloutSoak by default
+	Owner					string	 `json:"Owner,omitempty"`  // person or team responsible for the task
+	Labels					[]string `json:"Labels,omitempty"`
+	Placement				string	 `json:"Placement,omitempty"`  // earliest, closest, latest or least-disruption
+}
+
+type DependencyReq struct {
+	TaskID	string `json:"TaskID"`
+	Lag		string `json:"Lag,omitempty"` // minimum gap after the dependency ends
+}
+
+type SetDependenciesReq struct {
+	Dependencies []DependencyReq `json:"Dependencies"`
+}
+
+type SeriesReq struct {
+	Name			string	 `json:"Name"`
+	Cron			string	 `json:"Cron,omitempty"` // 5-field cron: minute hour day month weekday
+	RRule			string	 `json:"RRule,omitempty"` // e.g. FREQ=WEEKLY;BYDAY=SA;BYHOUR=2
+	StartDatetime	string	 `json:"StartDatetime,omitempty"` // now by default
+	Timezone		string	 `json:"Timezone,omitempty"` // IANA timezone of Cron/RRule times, of the first zone by default
+	Duration		string	 `json:"Duration"`
+	Window			string	 `json:"Window,omitempty"` // how much later an occurrence can be placed if its slot is taken
+	Zones			[]string `json:"Zones"`
+	Type			string	 `json:"Type"`
+	Critical		bool	 `json:"Critical"`
+	CompressionPerc	int		 `json:"CompressionPerc,omitempty"`
+	Owner			string	 `json:"Owner,omitempty"`
+	Labels			[]string `json:"Labels,omitempty"`
+}
+
+type OverrideReq struct {
+	Occurrence		string `json:"Occurrence"` // start of the occurrence as in the series
+	Skip			bool   `json:"Skip,omitempty"`
+	StartDatetime	string `json:"StartDatetime,omitempty"`
+	Duration		string `json:"Duration,omitempty"`
+}
+
+type FreezeReq struct {
+	Name	string	 `json:"Name"`
+	Zones	[]string `json:"Zones,omitempty"` // all zones if empty
+	Start	string	 `json:"Start"`
+	End		string	 `json:"End"`
+}
+
+type SuggestionsReq struct {
+	AddTaskReq
+	Count	int `json:"Count,omitempty"` // candidates per zone
 }
 
 type ExtendTaskReq struct {
@@ -20,6 +75,85 @@ type MoveTaskReq struct {
 	NewStartDateTime string `json:"StartDatetime"`
 }
 
+type ClaimTaskReq struct {
+	Executor	string `json:"Executor"`
+	Zone		string `json:"Zone"`
+}
+
+type HeartbeatReq struct {
+	Executor	string `json:"Executor"`
+	Progress	int    `json:"Progress"` // from 0 to 100
+}
+
+type ReportReq struct {
+	Executor	string `json:"Executor"`
+	Success		bool   `json:"Success"`
+	Message		string `json:"Message,omitempty"`
+}
+
+type SlotCandidate struct {
+	Zones					[]string
+	StartDatetime			time.Time
+	EndDatetime				time.Time
+	Displaced				[]string // lower-priority tasks that would be moved
+	DistanceFromPreferred	time.Duration
+	DeadlineSlack			time.Duration
+}
+
+// FreeSlotsResp is the per-zone free intervals for a task of Duration between From and To
+type FreeSlotsResp struct {
+	Duration	time.Duration
+	From		time.Time
+	To			time.Time
+	Zones		map[string][]FreeSlot
+}
+
+type SuggestionsResp struct {
+	Zones	map[string][]SlotCandidate // per-zone slots
+	Aligned	[]SlotCandidate // slots at the same time in all zones
+}
+
+// TaskResp is the task after add, move or extend with the tasks it preempted
+type TaskResp struct {
+	*Task
+	Placements	[]Placement `json:",omitempty"` // per-zone tasks of a split or rollout task
+	Preempted	[]Preemption
+}
+
+// TaskDetailResp is the task with aggregate status and per-zone placements if it was split
+type TaskDetailResp struct {
+	*Task
+	AggregateStatus	string		`json:",omitempty"`
+	Placements		[]Placement	`json:",omitempty"`
+}
+
+type SeriesResp struct {
+	*Series
+	Tasks	[]*Task // occurrences ordered by time
+}
+
+// FreezeResp is the added or imported freezes with the tasks moved out of them or cancelled
+type FreezeResp struct {
+	Freezes	[]*Freeze
+	Changes
+}
+
+// TasksPage is the page of tasks matching the query of GET /tasks
+type TasksPage struct {
+	Total	int // tasks matching the query
+	Offset	int
+	Limit	int `json:",omitempty"`
+	Tasks	[]*Task
+}
+
+type DryRunResp struct {
+	DryRun	bool
+	Task	json.RawMessage `json:",omitempty"` // task as it would be after the operation
+	Series	json.RawMessage `json:",omitempty"` // series with its occurrence tasks, for series operations
+	Freezes	json.RawMessage `json:",omitempty"` // added, imported or deleted freezes, for freeze operations
+	Changes
+}
+
 type PrettySchedule struct {
 	Name		string
 	ID 			string
@@ -27,4 +161,5 @@ type PrettySchedule struct {
 	EndTime 	string
 	Type 		string
 	Critical 	bool
+	ParentID	string `json:",omitempty"`
 }
\ No newline at end of file
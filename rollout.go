@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// scheduleRollout places a per-zone stage for every zone of the task in the listed order;
+// each stage depends on the previous one with the soak period as lag
+func scheduleRollout(parent *Task) error {
+	previous := ""
+	for i, zone := range parent.Zones {
+		stage := parent.clone()
+		stage.ID = derivedID(parent.ID, "stage", strconv.Itoa(i+1))
+		stage.Zones = []string{zone}
+		stage.ParentID = parent.ID
+		stage.Children = nil
+		stage.Stage = i + 1
+		stage.Soak = 0
+		stage.Status = "wait"
+		if previous != "" {
+			stage.Dependencies = append(stage.Dependencies, Dependency{TaskID: previous, Lag: parent.Soak})
+		}
+		tasks[stage.ID] = &stage
+		parent.Children = append(parent.Children, stage.ID)
+		if i == 0 { // the first stage starts when requested
+			err := scheduleTask(&stage, "wait")
+			if err != nil {
+				return withSuggestions(err, stage)
+			}
+		} else if err := placeStage(&stage); err != nil {
+			return err
+		}
+		previous = stage.ID
+	}
+	parent.Status = "rollout"
+	return nil
+}
+
+// placeStage schedules the stage in the first slot after its dependencies and soak
+func placeStage(stage *Task) error {
+	earliest, err := earliestStart(*stage)
+	if err != nil {
+		return err
+	}
+	if earliest.After(stage.StartDatetime) {
+		stage.StartDatetime = roundStart(stage.Type, earliest)
+	}
+	if placeEarliest(stage) {
+		return nil
+	}
+	return &APIError{
+		Code:    codeStageUnplaceable,
+		Message: fmt.Sprintf("can't place stage %d of task %s in zone %s before its deadline %v", stage.Stage, stage.ParentID, stage.Zones[0], stage.Deadline),
+		Zone:    stage.Zones[0],
+		TaskIDs: []string{stage.ID},
+	}
+}
+
+// rolloutStages returns per-zone stages of the rollout in order
+func rolloutStages(parent *Task) []*Task {
+	stages := []*Task{}
+	for _, childID := range parent.Children {
+		if child, ok := tasks[childID]; ok {
+			stages = append(stages, child)
+		}
+	}
+	sort.Slice(stages, func(i, j int) bool {
+		return stages[i].Stage < stages[j].Stage
+	})
+	return stages
+}
+
+// pauseRollout frees the slots of waiting stages after the failed stage until the rollout is resumed
+func pauseRollout(failed *Task) {
+	if failed.Stage == 0 {
+		return
+	}
+	parent, ok := tasks[failed.ParentID]
+	if !ok {
+		return
+	}
+	for _, stage := range rolloutStages(parent) {
+		if stage.Stage > failed.Stage && stage.Status == "wait" {
+			unscheduleTask(stage.ID)
+			stage.Status = "paused"
+			log.Warn(fmt.Sprintf("Paused stage %d of task %s in zone %s", stage.Stage, parent.ID, stage.Zones[0]))
+		}
+	}
+}
+
+// resumeStages places paused stages anew from now on; failed stages they depend on are skipped
+func resumeStages(parent *Task) error {
+	resumed := 0
+	for _, stage := range rolloutStages(parent) {
+		if stage.Status != "paused" {
+			continue
+		}
+		dependencies := []Dependency{}
+		for _, dependency := range stage.Dependencies {
+			if dependencyTask, ok := tasks[dependency.TaskID]; ok && dependencyTask.Status == "failed" && dependencyTask.ParentID == parent.ID {
+				continue
+			}
+			dependencies = append(dependencies, dependency)
+		}
+		stage.Dependencies = dependencies
+		stage.Status = "wait"
+		if now := roundStart(stage.Type, clock.Now()); stage.StartDatetime.Before(now) {
+			stage.StartDatetime = now
+		}
+		if err := placeStage(stage); err != nil {
+			return err
+		}
+		resumed++
+	}
+	if resumed == 0 {
+		return newAPIError(codeInvalidStatus, "task %s has no paused stages", parent.ID)
+	}
+	return nil
+}
+
+func resumeRollout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	taskID := mux.Vars(r)["uuid"]
+	var resp []byte
+	apply := func() error {
+		task, ok := tasks[taskID]
+		if !ok {
+			return newAPIError(codeTaskNotFound, "No task with this ID %s", taskID)
+		}
+		if task.Stage > 0 { // resume by any stage ID too
+			task, ok = tasks[task.ParentID]
+			if !ok {
+				return newAPIError(codeTaskNotFound, "No task with this ID %s", taskID)
+			}
+		}
+		if task.Status != "rollout" {
+			return newAPIError(codeInvalidStatus, "Can only resume rollout tasks %s", taskID)
+		}
+		err := resumeStages(task)
+		if err != nil {
+			return err
+		}
+		resp, err = json.Marshal(inRequestLocation(r, newTaskResp(task)))
+		return err
+	}
+	if isDryRun(r) {
+		writeDryRun(w, r, apply, &resp, taskID)
+		return
+	}
+	err := engine.Update(apply)
+	if err != nil {
+		updateError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info("Resumed rollout of task ", taskID)
+}
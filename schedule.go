@@ -7,7 +7,6 @@ import (
 	"strings"
 
 	log "github.com/sirupsen/logrus"
-	"go.uber.org/multierr"
 	"github.com/google/uuid"
 )
 
@@ -21,6 +20,61 @@ func priorityRule(typeStr string, critical bool) int {
 	return 2
 }
 
+// validateDuration checks task duration against durations config; zero limits (null in config) are not enforced
+func validateDuration(typeStr string, critical bool, duration time.Duration) error {
+	if duration <= 0 {
+		return newAPIError(codeInvalidRequest, "duration should be positive, got %v", duration)
+	}
+	if typeStr == "auto" && durations.MinAutoDuration > 0 && duration < durations.MinAutoDuration {
+		return newAPIError(codeDurationTooShort, "duration %v is less than minAutoDuration %v", duration, durations.MinAutoDuration)
+	}
+	if typeStr == "manual" && durations.MinManualDuration > 0 && duration < durations.MinManualDuration {
+		return newAPIError(codeDurationTooShort, "duration %v is less than minManualDuration %v", duration, durations.MinManualDuration)
+	}
+	if !critical && durations.MaxNoncritDuration > 0 && duration > durations.MaxNoncritDuration {
+		return newAPIError(codeDurationTooLong, "duration %v is more than maxNoncritDuration %v", duration, durations.MaxNoncritDuration)
+	}
+	if critical && durations.MaxCritDuration > 0 && duration > durations.MaxCritDuration {
+		return newAPIError(codeDurationTooLong, "duration %v is more than maxCritDuration %v", duration, durations.MaxCritDuration)
+	}
+	return nil
+}
+
+// roundStart rounds start time up to preferredManualStartMult or preferredAutoStartMult
+func roundStart(typeStr string, start time.Time) time.Time {
+	mult := durations.PreferredAutoStartMult
+	if typeStr == "manual" {
+		mult = durations.PreferredManualStartMult
+	}
+	if mult <= 0 {
+		return start
+	}
+	rounded := start.Truncate(mult)
+	if rounded.Before(start) {
+		rounded = rounded.Add(mult)
+	}
+	return rounded
+}
+
+// roundStartDown rounds the start down to the multiple for the task type, for starts that shouldn't get later
+func roundStartDown(typeStr string, start time.Time) time.Time {
+	mult := durations.PreferredAutoStartMult
+	if typeStr == "manual" {
+		mult = durations.PreferredManualStartMult
+	}
+	if mult <= 0 {
+		return start
+	}
+	return start.Truncate(mult)
+}
+
+func latest(a time.Time, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
 func removeDuplicateTime(timeSlice []time.Time) []time.Time {
     allKeys := make(map[time.Time]bool)
     list := []time.Time{}
@@ -45,91 +99,306 @@ type Task struct {
 	Critical 				bool // only for manual type
 	Priority 				int // 0 for critical, 1, for manual noncritical, 2 for auto
 	CompressionPerc 		int // from 0 to 100; for auto only
-	Status 					string // wait, suggested, cancel, change (move + extend, enables rescheduling for <= prioritized) (progress and complete in production)
+	Status 					string // wait, suggested, cancel, change (move + extend, enables rescheduling for <= prioritized), progress, complete, failed, split, rollout, paused
+	ActualStartDatetime		*time.Time `json:",omitempty"` // set when task goes to progress
+	ActualEndDatetime		*time.Time `json:",omitempty"` // set when task completes or fails
+	Executor				string `json:",omitempty"` // executor that claimed auto task
+	LastHeartbeat			*time.Time `json:",omitempty"`
+	Progress				int `json:",omitempty"` // from 0 to 100, reported by executor
+	Result					string `json:",omitempty"` // executor report or failure reason
+	Preemptions				[]Preemption `json:",omitempty"` // history of slots lost to higher-priority tasks
+	ParentID				string `json:",omitempty"` // multi-zone task this per-zone task was split from
+	Children				[]string `json:",omitempty"` // per-zone tasks of a split task
+	Dependencies			[]Dependency `json:",omitempty"` // tasks that should end before this one starts
+	Soak					time.Duration `json:",omitempty"` // pause between stages of a rollout task
+	Stage					int `json:",omitempty"` // position of a per-zone task in its rollout, from 1
+	SeriesID				string `json:",omitempty"` // recurring series the task is an occurrence of
+	Occurrence				*time.Time `json:",omitempty"` // start of the occurrence in the series before overrides
+	Owner					string `json:",omitempty"` // person or team responsible for the task
+	Labels					[]string `json:",omitempty"` // free-form tags to filter tasks by
+	Revision				int // incremented when the slot, status or name of the task changes
+	Placement				string `json:",omitempty"` // placement strategy when the task is re-placed; from config if empty
+	CreatedAt				time.Time // time the task was requested or its series occurrence expanded
+	UpdatedAt				time.Time // time of the last change counted in Revision
+}
+
+func (task Task) clone() Task {
+	task.Zones = append([]string{}, task.Zones...)
+	task.Preemptions = append([]Preemption(nil), task.Preemptions...)
+	task.Children = append([]string(nil), task.Children...)
+	task.Dependencies = append([]Dependency(nil), task.Dependencies...)
+	task.Labels = append([]string(nil), task.Labels...)
+	return task
 }
 
 var tasks = make(map[string]*Task)
 
-type ScheduleZone []string
-var schedule = make(map[string]ScheduleZone)
+// taskOrderLess is the order in which tasks placed together are processed: by priority, then creation time, then ID
+func taskOrderLess(a *Task, b *Task) bool {
+	if a.Priority != b.Priority {
+		return a.Priority < b.Priority
+	}
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID < b.ID
+}
+
+// derivedID is a UUID derived from parts, e.g. the parent task and the zone, so that the same operation
+// creates tasks with the same IDs; it is never the ID of an existing task
+func derivedID(parts ...string) string {
+	id := uuid.NewSHA1(uuid.NameSpaceOID, []byte(strings.Join(parts, "/"))).String()
+	for _, ok := tasks[id]; ok; _, ok = tasks[id] {
+		id = uuid.NewSHA1(uuid.NameSpaceOID, []byte(id)).String()
+	}
+	return id
+}
+
+var schedule = make(map[string]*zoneIndex)
+
+// stateSnapshot is a deep copy of the state used to roll back failed requests and to compare states;
+// failed attempts to place a single task are rolled back with an undoLog instead
+type stateSnapshot struct {
+	tasks		map[string]Task
+	schedule	map[string]*zoneIndex
+	series		map[string]Series
+	freezes		map[string]Freeze
+	reports		map[string]*ReloadReport // reports aren't changed once recorded
+	preemptions	int // length of preemptionLog
+}
+
+func snapshotState() stateSnapshot {
+	snapshot := stateSnapshot{
+		tasks: make(map[string]Task, len(tasks)),
+		schedule: make(map[string]*zoneIndex, len(schedule)),
+		series: make(map[string]Series, len(recurringSeries)),
+		freezes: make(map[string]Freeze, len(freezes)),
+		reports: make(map[string]*ReloadReport, len(reloadReports)),
+		preemptions: len(preemptionLog),
+	}
+	for taskId, task := range tasks {
+		snapshot.tasks[taskId] = task.clone()
+	}
+	for seriesID, s := range recurringSeries {
+		snapshot.series[seriesID] = s.clone()
+	}
+	for freezeID, freeze := range freezes {
+		snapshot.freezes[freezeID] = freeze.clone()
+	}
+	for reportID, report := range reloadReports {
+		snapshot.reports[reportID] = report
+	}
+	for zone, zoneSchedule := range schedule {
+		snapshot.schedule[zone] = zoneSchedule.clone()
+	}
+	return snapshot
+}
+
+func restoreState(snapshot stateSnapshot) {
+	restored := make(map[string]*Task, len(snapshot.tasks))
+	for taskId, task := range snapshot.tasks {
+		task = task.clone()
+		if current, ok := tasks[taskId]; ok { // keep pointers held by callers valid
+			*current = task
+			restored[taskId] = current
+			continue
+		}
+		restored[taskId] = &task
+	}
+	tasks = restored
+	schedule = make(map[string]*zoneIndex, len(snapshot.schedule))
+	for zone, zoneSchedule := range snapshot.schedule {
+		schedule[zone] = zoneSchedule.clone()
+	}
+	restoredSeries := make(map[string]*Series, len(snapshot.series))
+	for seriesID, s := range snapshot.series {
+		s = s.clone()
+		if current, ok := recurringSeries[seriesID]; ok {
+			*current = s
+			restoredSeries[seriesID] = current
+			continue
+		}
+		restoredSeries[seriesID] = &s
+	}
+	recurringSeries = restoredSeries
+	freezes = make(map[string]*Freeze, len(snapshot.freezes))
+	for freezeID, freeze := range snapshot.freezes {
+		freeze = freeze.clone()
+		freezes[freezeID] = &freeze
+	}
+	reloadReports = make(map[string]*ReloadReport, len(snapshot.reports))
+	for reportID, report := range snapshot.reports {
+		reloadReports[reportID] = report
+	}
+	if snapshot.preemptions < len(preemptionLog) {
+		preemptionLog = preemptionLog[:snapshot.preemptions]
+	}
+}
+
+func unscheduleTask(taskId string) {  // removes task from all zones specified for the task
+	task, ok := tasks[taskId]
+	if !ok {
+		return
+	}
+	for _, zone := range task.Zones {
+		if zoneSchedule, ok := schedule[zone]; ok {
+			recordSpan(zone, taskId)
+			zoneSchedule.remove(taskId)
+		}
+	}
+}
 
 func cancelTask(taskId string) {  // tasks are cancelled in all zones specified for the task
 	log.Debug("Cancelling task ", taskId)
 	_, ok := tasks[taskId]
 	if ok {
-		for _, zone := range tasks[taskId].Zones {
-			idx := 0
-			for i := range schedule[zone] {
-				if schedule[zone][i] == taskId {
-					idx = i
-				}
-			}
-			schedule[zone] = append(schedule[zone][:idx], schedule[zone][idx+1:]...)
-		}
+		unscheduleTask(taskId)
+		recordTask(taskId)
 		tasks[taskId].Status = "cancel"
 	}
 }
 
-func wipeTask(taskId string) {
-	cancelTask(taskId)
-	delete(tasks, taskId)
-}
-
-func insertTask(taskId string, idx int, zone string) {
+func insertTask(taskId string, zone string) {  // the zone index keeps the slot the task has now
 	log.Debug("Inserting task ", taskId, " into schedule...")
-	if len(schedule[zone]) == idx { // nil or empty slice or after last element
-        schedule[zone] = append(schedule[zone], taskId)
-		return
-    }
-    schedule[zone] = append(schedule[zone][:idx+1], schedule[zone][idx:]...) // index < len(schedue)
-    schedule[zone][idx] = taskId
+	if _, ok := schedule[zone]; !ok {
+		schedule[zone] = newZoneIndex()
+		recordZone(zone)
+	}
+	recordSpan(zone, taskId)
+	task := tasks[taskId]
+	schedule[zone].insert(taskId, task.StartDatetime, task.StartDatetime.Add(task.Duration))
 }
 
-func splitTask(task Task) []string {  // splitting done for rescheduling + compression if available
+func splitTask(task Task) ([]string, error) {  // splitting done for rescheduling + compression if available
 	if len(task.Zones) == 1 {
-		return []string{task.ID}
+		return []string{task.ID}, nil
 	}
 	newTaskIds := []string{}
 	for _, zone := range task.Zones {
 		newTask := task
-		newTask.ID = uuid.New().String()
+		newTask.ID = derivedID(task.ID, "split", zone)
 		newTask.Zones = []string{zone}
+		newTask.Preemptions = nil
+		newTask.ParentID = task.ID
+		newTask.Children = nil
 		newTask.StartDatetime = newTask.PreferredStartDatetime
 		newTask.Duration = time.Duration(int(task.Duration.Nanoseconds()) * (100 - task.CompressionPerc) / 100)
+		err := validateDuration(newTask.Type, newTask.Critical, newTask.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("can't split task %s for zone %s with %d%% compression: %w", task.ID, zone, task.CompressionPerc, err)
+		}
+		recordTask(newTask.ID)
 		tasks[newTask.ID] = &newTask
 		newTaskIds = append(newTaskIds, newTask.ID)
 	}
-	return newTaskIds
+	recordTask(task.ID)
+	tasks[task.ID].Children = append(tasks[task.ID].Children, newTaskIds...)
+	tasks[task.ID].Status = "split"
+	return newTaskIds, nil
 }
 
 type Order struct {
 	zone			string
 	reschedTaskIds 	[]string
-	addIdx			int
 	taskID			string
 }
 
-func executeOrder(order Order) {
-	for _, taskId := range order.reschedTaskIds {
+// executeOrders cancels every displaced task once, places the task in all zones and only then re-places the displaced tasks,
+// so they can't take the slots freed for the task in another zone; a displaced task left without a slot is cancelled
+func executeOrders(orders []Order) error {
+	displaced := []string{}
+	seen := make(map[string]bool)
+	for _, order := range orders {
+		for _, taskId := range order.reschedTaskIds {
+			if !seen[taskId] {
+				seen[taskId] = true
+				displaced = append(displaced, taskId)
+			}
+		}
+	}
+	preemptions := make(map[string]Preemption, len(displaced))
+	for _, taskId := range displaced {
+		task := tasks[taskId]
+		preemptions[taskId] = Preemption{
+			TaskID: taskId,
+			PreemptedBy: orders[0].taskID,
+			Datetime: clock.Now(),
+			OldStartDatetime: task.StartDatetime,
+			OldEndDatetime: task.StartDatetime.Add(task.Duration),
+			Outcome: "moved",
+		}
 		cancelTask(taskId)
 	}
-	insertTask(order.taskID, order.addIdx, order.zone)
-	for _, taskId := range order.reschedTaskIds {
-		splitTaskIds := splitTask(*tasks[taskId])
+	for _, order := range orders {
+		insertTask(order.taskID, order.zone)
+	}
+	for _, taskId := range displaced {
+		preemption := preemptions[taskId]
+		splitTaskIds, err := splitTask(*tasks[taskId])
+		if err != nil { // per-zone tasks would be too short to place anywhere
+			err = cancelDisplaced(taskId, taskId, orders[0].taskID, err)
+			if err != nil {
+				return err
+			}
+			preemption.Outcome = "cancelled"
+			recordPreemption(preemption)
+			continue
+		}
+		if len(splitTaskIds) > 1 {
+			preemption.Outcome = "split"
+		}
 		for _, newTaskId := range splitTaskIds {
 			newTask := tasks[newTaskId]
-			points := suggestTime(*newTask)
-			if len(points) == 0 {
-				log.Warn(fmt.Sprintf("Cancelled split task %s for zone %v from parent task %s", newTaskId, newTask.Zones, taskId))
-				continue
-			}
-			newTask.StartDatetime = points[newTask.Zones[0]]
-			err := scheduleTask(tasks[newTaskId], "wait")
+			err := replaceDisplaced(newTask)
 			if err != nil {
-				log.Warn(fmt.Sprintf("Cancelled split task %s for zone %v from parent task %s", newTaskId, newTask.Zones, taskId))
+				err = cancelDisplaced(newTaskId, taskId, orders[0].taskID, err)
+				if err != nil {
+					return err
+				}
+				continue
 			}
+			log.Debug(fmt.Sprintf("Re-placed displaced task %s for zone %v from parent task %s", newTaskId, newTask.Zones, taskId))
+			preemption.Placements = append(preemption.Placements, Placement{
+				TaskID: newTaskId,
+				Zones: newTask.Zones,
+				StartDatetime: newTask.StartDatetime,
+				EndDatetime: newTask.StartDatetime.Add(newTask.Duration),
+			})
+		}
+		if len(preemption.Placements) == 0 {
+			preemption.Outcome = "cancelled"
 		}
+		recordPreemption(preemption)
 	}
+	return nil
+}
+
+// replaceDisplaced places the displaced task (or a per-zone task split from it) in the best slot suggested for it
+func replaceDisplaced(task *Task) error {
+	points := suggestTime(*task)
+	if len(points) == 0 {
+		return fmt.Errorf("no free slot before its deadline %v", task.Deadline)
+	}
+	task.StartDatetime = points[task.Zones[0]]
+	task.Status = "wait"
+	return scheduleTask(task, "wait")
+}
+
+// cancelDisplaced cancels a displaced task that can't be re-placed, so the higher-priority task keeps its slot;
+// the operation fails instead if tasks depend on the displaced one, as they would be left without their dependency
+func cancelDisplaced(taskId string, parentId string, preemptedBy string, reason error) error {
+	if active := activeDependents(parentId); len(active) > 0 {
+		return &APIError{
+			Code: codeDisplacementFailed,
+			Message: fmt.Sprintf("can't re-place displaced task %s from parent task %s that tasks depend on: %s", taskId, parentId, reason.Error()),
+			Zone: tasks[taskId].Zones[0],
+			TaskIDs: append([]string{parentId}, active...),
+		}
+	}
+	cancelTask(taskId)
+	tasks[taskId].Result = fmt.Sprintf("displaced by task %s and can't be re-placed: %s", preemptedBy, reason.Error())
+	log.Warn(fmt.Sprintf("Cancelled displaced task %s from parent task %s: %s", taskId, parentId, reason.Error()))
+	return nil
 }
 
 func overlap(start1 time.Time, end1 time.Time, start2 time.Time, end2 time.Time) bool {
@@ -143,44 +412,41 @@ func overlap(start1 time.Time, end1 time.Time, start2 time.Time, end2 time.Time)
 }
 
 func pointsOfInterestTime(addPoints []time.Time) []time.Time {
-	// merge starttimes and endtimes from all zones
+	// merge starttimes and endtimes from all zones of tasks not over (with pause) before the earliest of addPoints
+	from := addPoints[0]
+	for _, point := range addPoints {
+		if point.Before(from) {
+			from = point
+		}
+	}
 	pointsTime := []time.Time{}
 	for zone := range config.WhiteList {
-		zoneSchedule, ok := schedule[zone]
-		if ok {
-			for i := range zoneSchedule {
-				pointsTime = append(pointsTime, tasks[zoneSchedule[i]].StartDatetime)
-				pointsTime = append(pointsTime, tasks[zoneSchedule[i]].StartDatetime.Add(tasks[zoneSchedule[i]].Duration).Add(config.Pauses[zone]))
-			}
+		for _, s := range schedule[zone].endingAfter(from.Add(-config.Pauses[zone])) {
+			pointsTime = append(pointsTime, s.Start)
+			pointsTime = append(pointsTime, s.End.Add(config.Pauses[zone]))
 		}
 	}
 	// and add addPoints
 	pointsTime = append(pointsTime, addPoints...)
 	pointsTime = removeDuplicateTime(pointsTime)
 
-	// merge all timezone whitelist times
-	configZonePoints := []time.Time{}
-	for _, timeSpans := range config.WhiteList {
-		for _, timeSpan := range timeSpans {
-			configZonePoints = append(configZonePoints, timeSpan.Start)
-			configZonePoints = append(configZonePoints, timeSpan.End)
-		}
-	}
-	configZonePoints = removeDuplicateTime(configZonePoints)
-
-	// sort to get the earliest and latest and add timezone work start times
+	// sort to get the earliest and latest and add starts and ends of whitelist windows and blocks on these days
 	sort.Slice(pointsTime, func(i, j int) bool {
 		return pointsTime[i].Before(pointsTime[j])
 	})
 	pointsTime = removeDuplicateTime(pointsTime)
 	earliest := pointsTime[0]
 	latest := pointsTime[len(pointsTime) - 1]
-	for day := 0; day < int(latest.Sub(earliest).Hours()) / 24 + 1; day++ {
-		earliest = earliest.Add(time.Hour * 24)
-		for _, zonePoint := range configZonePoints {
-			pointsTime = append(pointsTime, time.Date(earliest.Year(), earliest.Month(), earliest.Day(), zonePoint.Hour(), zonePoint.Minute(), zonePoint.Second(), zonePoint.Nanosecond(), zonePoint.Location()))
+	for zone := range config.WhiteList {
+		windows, blocked := zoneWindows(zone, earliest, latest.Add(time.Hour * 48))
+		for _, window := range append(windows, blocked...) {
+			pointsTime = append(pointsTime, window.Start, window.End)
 		}
 	}
+	for _, freeze := range allFreezes() {
+		pointsTime = append(pointsTime, freeze.Start, freeze.End)
+	}
+	pointsTime = removeDuplicateTime(pointsTime)
 
 	// resulting sort
 	sort.Slice(pointsTime, func(i, j int) bool {
@@ -190,52 +456,87 @@ func pointsOfInterestTime(addPoints []time.Time) []time.Time {
 }
 
 func suggestTime(task Task) map[string]time.Time {
+	// dummy tasks are placed to account for earlier zones, the state is rolled back afterwards
+	beginUndo()
+	defer rollbackUndo()
 	suggestions := make(map[string]time.Time)
 	// create slice with points of interest (merge times from all zones, insert starts of available time zone times) and sort
+	earliest, err := earliestStart(task)
+	if err != nil {
+		log.Debug(err)
+		return nil
+	}
 	addPoints := []time.Time{task.StartDatetime}
+	if earliest.After(task.StartDatetime) {
+		addPoints = append(addPoints, earliest)
+	}
 	for _, zone := range task.Zones {
 		addPoints = append(addPoints, task.StartDatetime.Add(task.Duration).Add(config.Pauses[zone]))
 	}
 	pointsTime := pointsOfInterestTime(addPoints)
-	fmt.Println(pointsTime)
+	log.Debug("Points of interest: ", pointsTime)
+	starts := []time.Time{}
+	for _, point := range pointsTime {
+		if point.Before(task.StartDatetime) || point.Before(earliest) {
+			continue
+		}
+		point = roundStart(task.Type, point)
+		if point.Add(task.Duration).After(task.Deadline) {
+			break
+		}
+		starts = append(starts, point)
+	}
+	ends := endAlignedStarts(task, pointsTime)
 
 	// split tasks and create dummies for each
-	dummyTasks := []string{}
 	for _, zone := range task.Zones {
 		dummyTask := task
-		dummyTask.ID = uuid.New().String()
+		dummyTask.ID = derivedID(task.ID, "suggested", zone)
 		dummyTask.Status = "suggested"
 		dummyTask.Zones = []string{zone}
-		for _, point := range pointsTime {
-			if point.Before(task.StartDatetime) {
-				continue
+		// starts from blockedFrom to blockedTo overlap tasks in the zone that the dummy task can't displace
+		blocks := func(taskID string) bool {
+			schedTask := tasks[taskID]
+			return schedTask.Priority <= dummyTask.Priority && schedTask.Status != "cancel"
+		}
+		blockedFrom, blockedTo := time.Time{}, time.Time{}
+		fits := func(point time.Time) (int, bool) {
+			if point.Before(task.StartDatetime) || point.Before(earliest) || point.Add(task.Duration).After(task.Deadline) {
+				return 0, false
+			}
+			if !point.Before(blockedFrom) && point.Before(blockedTo) {
+				return 0, false
 			}
-			if point.Add(task.Duration).After(task.Deadline) {
-			 	break
+			if fit := schedule[zone].earliestFit(point, task.Duration, config.Pauses[zone], blocks); fit.After(point) {
+				blockedFrom, blockedTo = point, fit
+				return 0, false
 			}
 			dummyTask.StartDatetime = point
 			err := availableTimeZone(&dummyTask)
 			if err != nil {
-				fmt.Println(err)
-				continue
+				log.Debug(err)
+				return 0, false
 			}
 			dummyOrder, err := availablePrioritizedTimespan(&dummyTask, zone)
 			if err != nil {
-				fmt.Println(err)
-				continue
+				log.Debug(err)
+				return 0, false
 			}
-			dummyOrder.reschedTaskIds = []string{}
-			fmt.Println(dummyOrder)
-			executeOrder(dummyOrder)
-			tasks[dummyTask.ID] = &dummyTask
-			dummyTasks = append(dummyTasks, dummyTask.ID)
-			suggestions[zone] = point
-			break
+			return len(dummyOrder.reschedTaskIds), true
 		}
-	}
-	// delete all dummy tasks
-	for _, dummy := range dummyTasks {
-		wipeTask(dummy)
+		point, ok := placementStrategy(task, zone).place(task, placementPoints{starts: starts, ends: ends, fits: fits})
+		if !ok {
+			continue
+		}
+		dummyTask.StartDatetime = point
+		dummyOrder, _ := availablePrioritizedTimespan(&dummyTask, zone)
+		dummyOrder.reschedTaskIds = []string{}
+		log.Debug("Suggested order: ", dummyOrder)
+		placed := dummyTask
+		recordTask(placed.ID)
+		tasks[placed.ID] = &placed
+		executeOrders([]Order{dummyOrder})
+		suggestions[zone] = point
 	}
 	if len(suggestions) < len(task.Zones) {
 		return nil
@@ -243,44 +544,28 @@ func suggestTime(task Task) map[string]time.Time {
 	return suggestions
 }
 
-func suggestTimeString(task Task) string {
-	points := suggestTime(task)
-	if len(points) == 0 {
-		return "Task REJECTED. No timespans are available."
-	}
-	suggestions := []string{}
-	for zone, point := range points {
-		suggestions = append(suggestions, fmt.Sprintf("  - %s: %s - %s", zone, point.Format("15:04 02/01/2006"), point.Add(task.Duration).Format("15:04 02/01/2006")))
-	} 
-	return "Please review suggested timespans:\n" + strings.Join(suggestions, "\n")
-}
-
 func countUnavailableZones(taskCount int, zone string, priority int, startTime time.Time, endTime time.Time) int {
 	unavailableZones := taskCount
 	splits := []time.Time{}
-	overlapIdxs := make(map[string][]int)
+	overlapSpans := []span{}  // of tasks in other zones
 	for whiteListZone, _ := range config.WhiteList {
 		if zone != whiteListZone {
-			zoneSchedule, ok := schedule[whiteListZone]
-			if ok {
-				for i := range zoneSchedule {
-					schedTask := tasks[zoneSchedule[i]]
-					schedStart := schedTask.StartDatetime
-					schedEnd := schedTask.StartDatetime.Add(schedTask.Duration)
-					if schedStart.After(startTime) && schedStart.Before(endTime) {
-						splits = append(splits, schedStart)
-					}
-					if schedEnd.After(startTime) && schedEnd.Before(endTime) {
-						splits = append(splits, schedEnd)
-					}
-					if overlap(schedStart, schedEnd, startTime, endTime) {
-						overlapIdxs[whiteListZone] = append(overlapIdxs[whiteListZone], i)
-					}
+			for _, s := range schedule[whiteListZone].overlapping(startTime, endTime) {
+				if s.Start.After(startTime) {
+					splits = append(splits, s.Start)
+				}
+				if s.End.Before(endTime) {
+					splits = append(splits, s.End)
 				}
+				overlapSpans = append(overlapSpans, s)
 			}
 		}
 	}
+	// zones come in map order, splits are taken in time order
 	splits = removeDuplicateTime(splits)
+	sort.Slice(splits, func(i, j int) bool {
+		return splits[i].Before(splits[j])
+	})
 	unavailablePerSplit := make([]int, len(splits))
 	for i, split := range splits {
 		startSplitTime := startTime
@@ -288,12 +573,10 @@ func countUnavailableZones(taskCount int, zone string, priority int, startTime t
 		if i != 0 {
 			startSplitTime = splits[i-1]
 		}
-		for zone, idxs := range overlapIdxs {
-			for _, idx := range idxs {
-				schedTask := tasks[schedule[zone][idx]]
-				if overlap(startSplitTime, endSplitTime, schedTask.StartDatetime, schedTask.StartDatetime.Add(schedTask.Duration)) && schedTask.Priority <= priority && schedTask.Status != "cancel" {
-					unavailablePerSplit[i] += 1
-				}
+		for _, s := range overlapSpans {
+			schedTask := tasks[s.TaskID]
+			if overlap(startSplitTime, endSplitTime, s.Start, s.End) && schedTask.Priority <= priority && schedTask.Status != "cancel" {
+				unavailablePerSplit[i] += 1
 			}
 		}
 	}
@@ -311,43 +594,33 @@ func availableTimeZone(task *Task) error {
 	// check that task is scheduled in available zone in available time
 	startTime := task.StartDatetime
 	endTime := task.StartDatetime.Add(task.Duration)
-	// hack: cut off the date part and reconvert to time.Time to compare with whiteListed timespans
-	startTimeConverted, _ := time.Parse("15:04", startTime.Format("15:04"))
-	endTimeConverted, _ := time.Parse("15:04", endTime.Format("15:04"))
 	for _, zone := range task.Zones {
 		zoneExists := false
 		for _, blackListZone := range config.BlackList {
 			if zone == blackListZone {
 				zoneExists = true
 				if !task.Critical {
-					return fmt.Errorf("one of zones is in blackList and task is not critical: %s", zone)
+					return &APIError{Code: codeZoneBlacklisted, Message: fmt.Sprintf("one of zones is in blackList and task is not critical: %s", zone), Zone: zone}
 				}
 			}
 		}
-		for whiteListZone, zoneTimeSpans := range config.WhiteList {
-			if zone == whiteListZone {
-				zoneExists = true
-				valid := false
-				for _, timeSpan := range zoneTimeSpans {
-					log.Debug(fmt.Sprintf("Comparing timespans... startTime: %v, endTime: %v, timeSpan: %v", startTimeConverted, endTimeConverted, timeSpan))
-					if overlap(startTimeConverted, endTimeConverted, timeSpan.Start, timeSpan.End) {
-						valid = true
-					}
-					if overlap(startTimeConverted.Add(time.Hour * 24), endTimeConverted.Add(time.Hour * 24), timeSpan.Start, timeSpan.End) {
-						valid = true
-					}
-				}
-				if !valid {
-					return fmt.Errorf("does not match any timespan in zone: %s", zone)
-				}
+		if _, ok := config.WhiteList[zone]; ok {
+			zoneExists = true
+			err := checkWhiteList(zone, startTime, endTime)
+			if err != nil {
+				return err
 			}
 		}
+		err := checkFreeze(task, zone, startTime, endTime)
+		if err != nil {
+			return err
+		}
 		unavailableZones := countUnavailableZones(len(task.Zones), zone, task.Priority, startTime, endTime)
 		if len(config.WhiteList) - unavailableZones  < config.AvailableZones {
-			return fmt.Errorf("can't schedule task; %d zones should be available at all times", config.AvailableZones)
+			return &APIError{Code: codeAvailableZonesViolated, Message: fmt.Sprintf("can't schedule task; %d zones should be available at all times", config.AvailableZones), Zone: zone}
 		}
 		if !zoneExists {
-			return fmt.Errorf("no such zone exists in config")
+			return &APIError{Code: codeUnknownZone, Message: fmt.Sprintf("no such zone exists in config: %s", zone), Zone: zone}
 		}
 	}
 	return nil
@@ -357,42 +630,42 @@ func availablePrioritizedTimespan(task *Task, zone string) (Order, error) {
 	order := Order{
 		zone: zone, 
 		taskID: task.ID,
+		reschedTaskIds: []string{},
 	}
-	startIdx := 0
-	zoneSchedule, ok := schedule[zone]
-	if ok {
-		overlaps := []int{}
-		for i := range zoneSchedule {
-			schedTask := tasks[zoneSchedule[i]]
-			schedTaskStart := schedTask.StartDatetime
-			schedTaskEnd := schedTaskStart.Add(tasks[zoneSchedule[i]].Duration).Add(config.Pauses[zone])  // added zone-specific pauses
-			if overlap(schedTaskStart, schedTaskEnd, task.StartDatetime, task.StartDatetime.Add(task.Duration)) {
-				overlaps = append(overlaps, i)
-			}
-			if !task.StartDatetime.Before(schedTaskEnd) {
-				startIdx = i + 1
+	if zoneSchedule, ok := schedule[zone]; ok {
+		overlaps := []string{}
+		// added zone-specific pauses after scheduled tasks
+		for _, s := range zoneSchedule.overlapping(task.StartDatetime.Add(-config.Pauses[zone]), task.StartDatetime.Add(task.Duration)) {
+			if s.TaskID != task.ID {
+				overlaps = append(overlaps, s.TaskID)
 			}
 		}
 		// no overlaps
 		if len(overlaps) == 0 {
-			order.reschedTaskIds = []string{}
-			order.addIdx = startIdx
 			return order, nil
 		}
 		// there are overlaps
 		// check priorities, status of scheduled tasks (if "cancel", then the task is set for cancellation/extension/rescheduling) and status of this task (if change, then this task can reschedule overlaps)
-		for _, i := range overlaps {
-			schedTask := tasks[zoneSchedule[i]]
+		var overlapErr *APIError
+		for _, taskID := range overlaps {
+			schedTask := tasks[taskID]
 			if schedTask.Priority <= task.Priority && schedTask.Status != "cancel" && task.Status != "change" {
-				return order, fmt.Errorf("can't schedule task; overlap in zone %s with task with priority %d %s (%s, critical: %v), %v-%v", zone, schedTask.Priority, schedTask.ID, schedTask.Type, schedTask.Critical, schedTask.StartDatetime, schedTask.StartDatetime.Add(schedTask.Duration))
+				if overlapErr == nil {
+					overlapErr = &APIError{
+						Code: codeOverlap,
+						Message: fmt.Sprintf("can't schedule task; overlap in zone %s with task with priority %d %s (%s, critical: %v), %v-%v", zone, schedTask.Priority, schedTask.ID, schedTask.Type, schedTask.Critical, schedTask.StartDatetime, schedTask.StartDatetime.Add(schedTask.Duration)),
+						Zone: zone,
+					}
+				}
+				overlapErr.TaskIDs = append(overlapErr.TaskIDs, schedTask.ID)
 			}
 		}
-		// no priority overlaps; reschedule with compression or cancel less prioritized overlapping tasks
-		for _, i := range overlaps {
-			order.reschedTaskIds = append(order.reschedTaskIds, tasks[zoneSchedule[i]].ID)
+		if overlapErr != nil {
+			return order, overlapErr
 		}
+		// no priority overlaps; reschedule with compression or cancel less prioritized overlapping tasks
+		order.reschedTaskIds = append(order.reschedTaskIds, overlaps...)
 	}
-	order.addIdx = startIdx
 	return order, nil
 }
 
@@ -405,51 +678,73 @@ func availableTimespan(task *Task) error {
 		}
 		orders = append(orders, order)
 	}
-	fmt.Println(orders)
-	for _, order := range orders {
-		log.Debug("Executing order in zone ", order.zone)
-		executeOrder(order)
-	}
-
-	return nil
+	log.Debug("Orders: ", orders)
+	return executeOrders(orders)
 }
 
+// scheduleTask places the task in all its zones or leaves tasks and schedule exactly as they were
 func scheduleTask(task *Task, assignStatus string) error {
+	beginUndo()
+	recordTask(task.ID)
 	status := task.Status
 	task.Status = assignStatus
+	unscheduleTask(task.ID) // moved and extended tasks are placed anew
+
+	err := checkDependencies(task)
+	if err != nil {
+		rollbackUndo()
+		return err
+	}
 
-	err := availableTimeZone(task)
+	err = availableTimeZone(task)
 	if err != nil {
-		task.Status = status
+		rollbackUndo()
 		return err
 	}
 	
 	err = availableTimespan(task)
 	if err != nil {
-		task.Status = status
+		rollbackUndo()
 		return err
 	}
 	task.Status = status
 
+	err = cascadeDependents(task.ID)
+	if err != nil {
+		rollbackUndo()
+		return err
+	}
+	commitUndo()
 	return nil
 }
 
-func reschedule() (errors error) {
+func reschedule() (failed map[string]error) {
+	failed = make(map[string]error)
 	statuses := make(map[string]string)
 	for taskID := range tasks {
 		statuses[taskID] = tasks[taskID].Status
-		cancelTask(taskID)
+		if statuses[taskID] == "wait" { // tasks in progress keep their slots
+			cancelTask(taskID)
+		}
 	}
-	for _, task := range tasks {
-		if statuses[task.ID] == "wait" {
-			err := scheduleTask(task, statuses[task.ID])
-			if err != nil {
-				cancelTask(task.ID)
-				errors = multierr.Append(errors, fmt.Errorf("%s: %w", task.ID,  err))
-			} else {
-				task.Status = statuses[task.ID]
-			}
+	waiting := []string{}
+	for taskID, status := range statuses {
+		if status == "wait" {
+			waiting = append(waiting, taskID)
+		}
+	}
+	for _, taskID := range topologicalOrder(waiting) { // dependencies are placed before their dependents
+		task := tasks[taskID]
+		err := scheduleTask(task, statuses[task.ID])
+		if err != nil && asAPIError(err, codeInternal).Code == codeZoneFrozen && placeEarliest(task) { // moved out of a freeze
+			err = nil
+		}
+		if err != nil {
+			cancelTask(task.ID)
+			failed[task.ID] = err
+		} else {
+			task.Status = statuses[task.ID]
 		}
 	}
-	return errors
+	return failed
 }
\ No newline at end of file
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// buildScenario places 300 tasks over six zones like requests would, then narrows a whitelist and reschedules
+func buildScenario(t *testing.T) (map[string][]string, map[string]time.Time) {
+	zones := []string{"dev1", "dev2", "dev3", "prod1", "prod2", "prod3"}
+	setupState(t, zones...)
+	config.AvailableZones = 2
+	rng := rand.New(rand.NewSource(42)) // the same tasks for every run
+	for i := 0; i < 300; i++ {
+		taskType := "auto"
+		if i%4 == 0 {
+			taskType = "manual"
+		}
+		taskZones := []string{}
+		for _, j := range rng.Perm(len(zones))[:1+rng.Intn(3)] {
+			taskZones = append(taskZones, zones[j])
+		}
+		start := testStart.Add(time.Duration(rng.Intn(7*24*4)) * 15 * time.Minute)
+		task := newTestTask(fmt.Sprintf("t%03d", i), taskType, start, time.Duration(1+rng.Intn(8))*15*time.Minute, taskZones...)
+		task.Critical = taskType == "manual" && i%20 == 0
+		task.Priority = priorityRule(task.Type, task.Critical)
+		if taskType == "auto" && len(taskZones) > 1 {
+			task.CompressionPerc = 20
+		}
+		task.CreatedAt = testStart.Add(time.Duration(i-300) * time.Second)
+		tasks[task.ID] = task
+		if !placeEarliest(task) {
+			delete(tasks, task.ID)
+		}
+	}
+	config.WhiteListRaw["prod1"] = []string{"08:00-20:00"}
+	if err := loadWhiteList(); err != nil {
+		t.Fatal(err)
+	}
+	reschedule()
+	return scheduleTaskIDs(), taskStarts()
+}
+
+func TestRescheduleIsDeterministic(t *testing.T) {
+	firstSchedule, firstStarts := buildScenario(t)
+	secondSchedule, secondStarts := buildScenario(t)
+	scheduled := 0
+	for _, taskIDs := range firstSchedule {
+		scheduled += len(taskIDs)
+	}
+	if scheduled < 100 {
+		t.Fatalf("only %d tasks scheduled, the scenario doesn't load the zones", scheduled)
+	}
+	if !reflect.DeepEqual(firstSchedule, secondSchedule) {
+		t.Fatal("two runs on the same tasks and config scheduled different tasks in the zones")
+	}
+	if !reflect.DeepEqual(firstStarts, secondStarts) {
+		t.Fatal("two runs on the same tasks and config gave tasks different IDs or starts")
+	}
+}
+
+func TestValidateDuration(t *testing.T) {
+	setupState(t, "dev1")
+	durations.MinAutoDuration = 5 * time.Minute
+	durations.MinManualDuration = 30 * time.Minute
+	durations.MaxNoncritDuration = 6 * time.Hour
+	durations.MaxCritDuration = 0 // null in config
+	cases := []struct {
+		taskType string
+		critical bool
+		duration time.Duration
+		code     string // empty if valid
+	}{
+		{taskType: "auto", duration: 5 * time.Minute},
+		{taskType: "auto", duration: 4 * time.Minute, code: codeDurationTooShort},
+		{taskType: "auto", duration: 0, code: codeInvalidRequest},
+		{taskType: "manual", duration: -time.Hour, code: codeInvalidRequest},
+		{taskType: "manual", duration: 10 * time.Minute, code: codeDurationTooShort},
+		{taskType: "manual", duration: 6 * time.Hour},
+		{taskType: "manual", duration: 6*time.Hour + time.Minute, code: codeDurationTooLong},
+		{taskType: "auto", duration: 7 * time.Hour, code: codeDurationTooLong},
+		{taskType: "manual", critical: true, duration: 48 * time.Hour},
+		{taskType: "manual", critical: true, duration: 10 * time.Minute, code: codeDurationTooShort},
+	}
+	for _, c := range cases {
+		err := validateDuration(c.taskType, c.critical, c.duration)
+		if c.code == "" && err != nil {
+			t.Errorf("%s task (critical: %v) of %v returned %v", c.taskType, c.critical, c.duration, err)
+		}
+		if c.code != "" && asAPIError(err, codeInternal).Code != c.code {
+			t.Errorf("%s task (critical: %v) of %v returned %v, want %s", c.taskType, c.critical, c.duration, err, c.code)
+		}
+	}
+
+	durations.MaxCritDuration = 12 * time.Hour
+	if err := validateDuration("manual", true, 13*time.Hour); asAPIError(err, codeInternal).Code != codeDurationTooLong {
+		t.Errorf("critical task over maxCritDuration returned %v, want %s", err, codeDurationTooLong)
+	}
+}
+
+func TestRoundStart(t *testing.T) {
+	setupState(t, "dev1")
+	cases := []struct {
+		taskType string
+		start    time.Duration // after testStart
+		up       time.Duration
+		down     time.Duration
+	}{
+		{taskType: "manual", start: 63 * time.Minute, up: 65 * time.Minute, down: 60 * time.Minute},
+		{taskType: "manual", start: 65 * time.Minute, up: 65 * time.Minute, down: 65 * time.Minute},
+		{taskType: "auto", start: 63*time.Minute + 30*time.Second, up: 64 * time.Minute, down: 63 * time.Minute},
+		{taskType: "auto", start: 63 * time.Minute, up: 63 * time.Minute, down: 63 * time.Minute},
+	}
+	for _, c := range cases {
+		start := testStart.Add(c.start)
+		if got := roundStart(c.taskType, start); !got.Equal(testStart.Add(c.up)) {
+			t.Errorf("%s start %v rounded up to %v, want %v", c.taskType, start, got, testStart.Add(c.up))
+		}
+		if got := roundStartDown(c.taskType, start); !got.Equal(testStart.Add(c.down)) {
+			t.Errorf("%s start %v rounded down to %v, want %v", c.taskType, start, got, testStart.Add(c.down))
+		}
+	}
+
+	durations.PreferredManualStartMult = 0 // null in config
+	if start := testStart.Add(63 * time.Minute); !roundStart("manual", start).Equal(start) {
+		t.Errorf("start rounded without a multiple in config")
+	}
+}
+
+func TestDurationLimitsOnRequests(t *testing.T) {
+	setupState(t, "dev1", "dev2")
+	durations.MinAutoDuration = 5 * time.Minute
+	durations.MinManualDuration = 30 * time.Minute
+
+	task, err := taskFromReq(AddTaskReq{Name: "short", Type: "manual", Zones: []string{"dev1"}, Duration: "10m", StartDatetime: "07/01/2030 01:00", Deadline: "08/01/2030 01:00"}, time.UTC)
+	if asAPIError(err, codeInternal).Code != codeDurationTooShort {
+		t.Fatalf("adding a 10m manual task returned %v, want %s", err, codeDurationTooShort)
+	}
+	task, err = taskFromReq(AddTaskReq{Name: "rounded", Type: "manual", Zones: []string{"dev1"}, Duration: "30m", StartDatetime: "07/01/2030 01:03", Deadline: "08/01/2030 01:00"}, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testStart.Add(65 * time.Minute); !task.StartDatetime.Equal(want) {
+		t.Fatalf("manual task starts at %v, want %v", task.StartDatetime, want)
+	}
+
+	// per-zone tasks split with compression are checked too
+	compressed := newTestTask("compressed", "auto", testStart.Add(time.Hour), 8*time.Minute, "dev1", "dev2")
+	compressed.CompressionPerc = 50
+	tasks[compressed.ID] = compressed
+	if _, err := splitTask(*compressed); asAPIError(err, codeInternal).Code != codeDurationTooShort {
+		t.Fatalf("splitting into 4m per-zone tasks returned %v, want %s", err, codeDurationTooShort)
+	}
+	if len(tasks) != 1 || compressed.Status != "wait" {
+		t.Fatalf("failed split left %d tasks and status %s", len(tasks), compressed.Status)
+	}
+}
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// Override changes a single occurrence of a series
+type Override struct {
+	Skip          bool          `json:",omitempty"`
+	StartDatetime *time.Time    `json:",omitempty"`
+	Duration      time.Duration `json:",omitempty"`
+}
+
+// Series is a recurring task definition expanded into tasks over the rolling horizon of deadlineDuration
+type Series struct {
+	ID              string
+	Name            string
+	Cron            string    `json:",omitempty"`
+	RRule           string    `json:",omitempty"`
+	StartDatetime   time.Time // no occurrences before it; DTSTART of RRule
+	Timezone        string    `json:",omitempty"` // occurrences are in local time of the timezone; UTC if empty
+	Duration        time.Duration
+	Window          time.Duration `json:",omitempty"` // how much later an occurrence can be placed if its slot is taken
+	Zones           []string
+	Type            string
+	Critical        bool
+	CompressionPerc int
+	Owner           string              `json:",omitempty"`
+	Labels          []string            `json:",omitempty"`
+	Status          string              // active or cancel
+	Overrides       map[string]Override `json:",omitempty"` // by occurrence start in RFC 3339
+	Occurrences     map[string]string   `json:",omitempty"` // occurrence start in RFC 3339 -> task ID
+}
+
+var recurringSeries = make(map[string]*Series)
+
+func (s Series) clone() Series {
+	s.Zones = append([]string{}, s.Zones...)
+	s.Labels = append([]string(nil), s.Labels...)
+	overrides := make(map[string]Override, len(s.Overrides))
+	for key, override := range s.Overrides {
+		overrides[key] = override
+	}
+	s.Overrides = overrides
+	occurrences := make(map[string]string, len(s.Occurrences))
+	for key, taskID := range s.Occurrences {
+		occurrences[key] = taskID
+	}
+	s.Occurrences = occurrences
+	return s
+}
+
+func occurrenceKey(occurrence time.Time) string {
+	return occurrence.UTC().Format(time.RFC3339)
+}
+
+func (s *Series) location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// recurrence expects times in the series location
+func (s *Series) recurrence() (recurrence, error) {
+	if s.Cron != "" {
+		return parseCron(s.Cron)
+	}
+	return parseRRule(s.RRule, s.StartDatetime.In(s.location()))
+}
+
+// maxSeriesOccurrences is the most occurrences a series may expand to over the deadline horizon, 1000 by default
+func maxSeriesOccurrences() int {
+	if config.MaxSeriesOccurrences <= 0 {
+		return 1000
+	}
+	return config.MaxSeriesOccurrences
+}
+
+// occurrencesAhead lists occurrences of the series from now (or its start) up to the horizon of deadlineDuration,
+// leaving room for the duration and window of the last one
+func (s *Series) occurrencesAhead(rec recurrence, now time.Time) []time.Time {
+	horizon := now.Add(durations.DeadlineDuration).Add(-s.Duration - s.Window)
+	from := latest(now, s.StartDatetime) // cron has no start of its own
+	return rec.between(from.In(s.location()), horizon.In(s.location()))
+}
+
+func seriesFromReq(seriesReq SeriesReq, loc *time.Location) (Series, error) {
+	if (seriesReq.Cron == "") == (seriesReq.RRule == "") {
+		return Series{}, newAPIError(codeInvalidRequest, "series should have either Cron or RRule")
+	}
+	if len(seriesReq.Zones) == 0 {
+		return Series{}, newAPIError(codeInvalidRequest, "series should have at least one zone")
+	}
+	if seriesReq.Type != "auto" && seriesReq.Type != "manual" {
+		return Series{}, newAPIError(codeInvalidRequest, "unknown type of task")
+	}
+	if seriesReq.Type == "auto" && seriesReq.Critical {
+		return Series{}, newAPIError(codeInvalidRequest, "auto tasks can't be critical")
+	}
+	if seriesReq.Type == "auto" && seriesReq.CompressionPerc > 100 {
+		return Series{}, newAPIError(codeInvalidRequest, "compression precentage for auto tasks can't be more than 100")
+	}
+	duration, err := time.ParseDuration(seriesReq.Duration)
+	if err != nil {
+		return Series{}, err
+	}
+	err = validateDuration(seriesReq.Type, seriesReq.Critical, duration)
+	if err != nil {
+		return Series{}, err
+	}
+	window := time.Duration(0)
+	if seriesReq.Window != "" {
+		window, err = time.ParseDuration(seriesReq.Window)
+		if err != nil {
+			return Series{}, err
+		}
+		if window < 0 {
+			return Series{}, newAPIError(codeInvalidRequest, "window can't be negative")
+		}
+	}
+	startDatetime := clock.Now()
+	if seriesReq.StartDatetime != "" {
+		startDatetime, err = parseDatetime(seriesReq.StartDatetime, loc)
+		if err != nil {
+			return Series{}, err
+		}
+	}
+	timezone := seriesReq.Timezone
+	if timezone == "" {
+		timezone = zoneLocation(seriesReq.Zones[0]).String()
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return Series{}, newAPIError(codeInvalidRequest, "unknown timezone %s", timezone)
+	}
+	series := Series{
+		Name:            seriesReq.Name,
+		Cron:            seriesReq.Cron,
+		RRule:           seriesReq.RRule,
+		StartDatetime:   startDatetime,
+		Timezone:        timezone,
+		Duration:        duration,
+		Window:          window,
+		Zones:           seriesReq.Zones,
+		Type:            seriesReq.Type,
+		Critical:        seriesReq.Critical,
+		CompressionPerc: seriesReq.CompressionPerc,
+		Owner:           seriesReq.Owner,
+		Labels:          seriesReq.Labels,
+		Status:          "active",
+	}
+	rec, err := series.recurrence()
+	if err != nil {
+		return Series{}, newAPIError(codeInvalidRequest, "%s", err.Error())
+	}
+	if occurrences := len(series.occurrencesAhead(rec, clock.Now())); occurrences > maxSeriesOccurrences() {
+		return Series{}, newAPIError(codeInvalidRequest, "series expands to %d occurrences up to the deadline horizon, at most %d are allowed", occurrences, maxSeriesOccurrences())
+	}
+	return series, nil
+}
+
+func (s *Series) occurrenceTask(occurrence time.Time, override Override) *Task {
+	start, duration := occurrence, s.Duration
+	if override.StartDatetime != nil {
+		start = *override.StartDatetime
+	}
+	if override.Duration > 0 {
+		duration = override.Duration
+	}
+	start = roundStart(s.Type, start)
+	return &Task{
+		ID:                     derivedID(s.ID, occurrenceKey(occurrence)),
+		Name:                   s.Name,
+		PreferredStartDatetime: start,
+		StartDatetime:          start,
+		Duration:               duration,
+		Deadline:               start.Add(duration).Add(s.Window),
+		Zones:                  append([]string{}, s.Zones...),
+		Type:                   s.Type,
+		Critical:               s.Critical,
+		Priority:               priorityRule(s.Type, s.Critical),
+		CompressionPerc:        s.CompressionPerc,
+		Status:                 "wait",
+		SeriesID:               s.ID,
+		Occurrence:             &occurrence,
+		Owner:                  s.Owner,
+		Labels:                 append([]string(nil), s.Labels...),
+		CreatedAt:              clock.Now(),
+	}
+}
+
+// expandSeries creates tasks for occurrences up to the horizon; an occurrence whose slot is taken is placed
+// in the first free slot within the window or skipped (cancelled with the reason in Result)
+func expandSeries(s *Series, now time.Time) {
+	if s.Status != "active" {
+		return
+	}
+	rec, err := s.recurrence()
+	if err != nil {
+		log.Error(fmt.Sprintf("Series %s: %s", s.ID, err.Error()))
+		return
+	}
+	occurrences := s.occurrencesAhead(rec, now)
+	if len(occurrences) > maxSeriesOccurrences() { // e.g. the limit was lowered on config reload
+		log.Warn(fmt.Sprintf("Series %s: expanding only the first %d of %d occurrences", s.ID, maxSeriesOccurrences(), len(occurrences)))
+		occurrences = occurrences[:maxSeriesOccurrences()]
+	}
+	for _, occurrence := range occurrences {
+		key := occurrenceKey(occurrence)
+		if _, ok := s.Occurrences[key]; ok {
+			continue
+		}
+		override := s.Overrides[key]
+		if override.Skip {
+			continue
+		}
+		task := s.occurrenceTask(occurrence, override)
+		tasks[task.ID] = task
+		s.Occurrences[key] = task.ID
+		if !placeEarliest(task) {
+			task.Status = "cancel"
+			task.Result = fmt.Sprintf("no free slot for occurrence %v within window %v", occurrence, s.Window)
+			log.Warn(fmt.Sprintf("Skipped occurrence %v of series %s: no free slot", occurrence, s.ID))
+			continue
+		}
+		log.Debug(fmt.Sprintf("Expanded occurrence %v of series %s into task %s", occurrence, s.ID, task.ID))
+	}
+}
+
+func expandAllSeries(now time.Time) {
+	seriesIDs := []string{}
+	for seriesID := range recurringSeries {
+		seriesIDs = append(seriesIDs, seriesID)
+	}
+	sort.Strings(seriesIDs)
+	for _, seriesID := range seriesIDs {
+		expandSeries(recurringSeries[seriesID], now)
+	}
+}
+
+// cancelFutureOccurrences cancels occurrences that haven't started and forgets them so they can be expanded anew
+func cancelFutureOccurrences(s *Series) {
+	for key, taskID := range s.Occurrences {
+		task, ok := tasks[taskID]
+		if !ok || task.Status == "wait" || task.Status == "cancel" {
+			if ok && task.Status == "wait" {
+				cancelTask(taskID)
+			}
+			delete(s.Occurrences, key)
+		}
+	}
+}
+
+func newSeriesResp(s *Series) SeriesResp {
+	resp := SeriesResp{Series: s, Tasks: []*Task{}}
+	for _, taskID := range s.Occurrences {
+		if task, ok := tasks[taskID]; ok {
+			resp.Tasks = append(resp.Tasks, task)
+		}
+	}
+	sort.Slice(resp.Tasks, func(i, j int) bool {
+		return resp.Tasks[i].Occurrence.Before(*resp.Tasks[j].Occurrence)
+	})
+	return resp
+}
+
+// writeSeriesDryRun reports what a series operation would change; its subjects are the occurrences of the series
+func writeSeriesDryRun(w http.ResponseWriter, r *http.Request, apply func() error, resp *[]byte, seriesID string) {
+	writeDryRunResp(w, r, apply, func(dryRunResp *DryRunResp) {
+		dryRunResp.Series = *resp
+	}, func() []string {
+		taskIDs := []string{}
+		if s, ok := recurringSeries[seriesID]; ok {
+			for _, taskID := range s.Occurrences {
+				taskIDs = append(taskIDs, taskID)
+			}
+		}
+		return taskIDs
+	})
+}
+
+// readSeriesReq reads the request body; it's turned into a series with seriesFromReq under the engine lock
+// as the default timezone comes from the zone config
+func readSeriesReq(w http.ResponseWriter, r *http.Request) (SeriesReq, bool) {
+	var seriesReq SeriesReq
+	reqBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		log.Warn(err)
+		return SeriesReq{}, false
+	}
+	json.Unmarshal(reqBody, &seriesReq)
+	return seriesReq, true
+}
+
+func addSeries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	seriesReq, ok := readSeriesReq(w, r)
+	if !ok {
+		return
+	}
+	seriesID := uuid.New().String()
+	var resp []byte
+	apply := func() error {
+		s, err := seriesFromReq(seriesReq, requestLocation(r))
+		if err != nil {
+			return err
+		}
+		s.ID = seriesID
+		s.Overrides = make(map[string]Override)
+		s.Occurrences = make(map[string]string)
+		recurringSeries[s.ID] = &s
+		expandSeries(&s, clock.Now())
+		resp, err = json.Marshal(inRequestLocation(r, newSeriesResp(&s)))
+		return err
+	}
+	if isDryRun(r) {
+		writeSeriesDryRun(w, r, apply, &resp, seriesID)
+		return
+	}
+	err := engine.Update(apply)
+	if err != nil {
+		updateError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	w.Write(resp)
+	log.Info("Added series ", seriesID)
+}
+
+func listSeries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	var resp []byte
+	var err error
+	engine.View(func() {
+		resp, err = json.Marshal(inRequestLocation(r, recurringSeries))
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		log.Error(err)
+		return
+	}
+	w.Write(resp)
+}
+
+func getSeries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	seriesID := mux.Vars(r)["uuid"]
+	var resp []byte
+	var err error
+	ok := false
+	engine.View(func() {
+		var s *Series
+		s, ok = recurringSeries[seriesID]
+		if ok {
+			resp, err = json.Marshal(inRequestLocation(r, newSeriesResp(s)))
+		}
+	})
+	if !ok {
+		writeError(w, http.StatusBadRequest, newAPIError(codeSeriesNotFound, "No series with this ID %s", seriesID))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		log.Error(err)
+		return
+	}
+	w.Write(resp)
+}
+
+// editSeries replaces the series definition; occurrences that haven't started are expanded anew, overrides are kept
+func editSeries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	seriesReq, ok := readSeriesReq(w, r)
+	if !ok {
+		return
+	}
+	seriesID := mux.Vars(r)["uuid"]
+	var resp []byte
+	apply := func() error {
+		s, ok := recurringSeries[seriesID]
+		if !ok {
+			return newAPIError(codeSeriesNotFound, "No series with this ID %s", seriesID)
+		}
+		if s.Status != "active" {
+			return newAPIError(codeInvalidStatus, "Can only edit active series %s", seriesID)
+		}
+		edited, err := seriesFromReq(seriesReq, requestLocation(r))
+		if err != nil {
+			return err
+		}
+		cancelFutureOccurrences(s)
+		edited.ID, edited.Overrides, edited.Occurrences = s.ID, s.Overrides, s.Occurrences
+		*s = edited
+		expandSeries(s, clock.Now())
+		resp, err = json.Marshal(inRequestLocation(r, newSeriesResp(s)))
+		return err
+	}
+	if isDryRun(r) {
+		writeSeriesDryRun(w, r, apply, &resp, seriesID)
+		return
+	}
+	err := engine.Update(apply)
+	if err != nil {
+		updateError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info("Edited series ", seriesID)
+}
+
+func deleteSeries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	seriesID := mux.Vars(r)["uuid"]
+	var resp []byte
+	apply := func() error {
+		s, ok := recurringSeries[seriesID]
+		if !ok {
+			return newAPIError(codeSeriesNotFound, "No series with this ID %s", seriesID)
+		}
+		for _, taskID := range s.Occurrences {
+			if task, ok := tasks[taskID]; ok && task.Status == "wait" {
+				cancelTask(taskID)
+			}
+		}
+		s.Status = "cancel"
+		var err error
+		resp, err = json.Marshal(inRequestLocation(r, newSeriesResp(s)))
+		return err
+	}
+	if isDryRun(r) {
+		writeSeriesDryRun(w, r, apply, &resp, seriesID)
+		return
+	}
+	err := engine.Update(apply)
+	if err != nil {
+		updateError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info("Cancelled series ", seriesID)
+}
+
+// overrideOccurrence skips, moves or resizes one occurrence; the override also applies if it isn't expanded yet
+func overrideOccurrence(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	var overrideReq OverrideReq
+	reqBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		log.Warn(err)
+		return
+	}
+	json.Unmarshal(reqBody, &overrideReq)
+	occurrence, err := parseDatetime(overrideReq.Occurrence, requestLocation(r))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		log.Warn(err)
+		return
+	}
+	override := Override{Skip: overrideReq.Skip}
+	if overrideReq.StartDatetime != "" {
+		start, err := parseDatetime(overrideReq.StartDatetime, requestLocation(r))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			log.Warn(err)
+			return
+		}
+		if start.Before(clock.Now()) {
+			err = newAPIError(codePastStart, "can't set tasks in the past")
+			writeError(w, http.StatusBadRequest, err)
+			log.Warn(err)
+			return
+		}
+		override.StartDatetime = &start
+	}
+	if overrideReq.Duration != "" {
+		override.Duration, err = time.ParseDuration(overrideReq.Duration)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			log.Warn(err)
+			return
+		}
+	}
+
+	seriesID := mux.Vars(r)["uuid"]
+	var resp []byte
+	apply := func() error {
+		s, ok := recurringSeries[seriesID]
+		if !ok {
+			return newAPIError(codeSeriesNotFound, "No series with this ID %s", seriesID)
+		}
+		if s.Status != "active" {
+			return newAPIError(codeInvalidStatus, "Can only change occurrences of active series %s", seriesID)
+		}
+		rec, err := s.recurrence()
+		if err != nil {
+			return err
+		}
+		if occurrences := rec.between(occurrence.In(s.location()), occurrence.In(s.location())); len(occurrences) == 0 || occurrence.Before(s.StartDatetime) {
+			return newAPIError(codeInvalidRequest, "%v is not an occurrence of series %s", occurrence, seriesID)
+		}
+		if override.Duration > 0 {
+			if err := validateDuration(s.Type, s.Critical, override.Duration); err != nil {
+				return err
+			}
+		}
+		key := occurrenceKey(occurrence)
+		s.Overrides[key] = override
+		if taskID, ok := s.Occurrences[key]; ok {
+			task := tasks[taskID]
+			switch {
+			case task.Status == "wait" && override.Skip:
+				cancelTask(taskID)
+				task.Result = "skipped"
+			case task.Status == "wait":
+				task.StartDatetime = roundStart(task.Type, occurrence)
+				if override.StartDatetime != nil {
+					task.StartDatetime = roundStart(task.Type, *override.StartDatetime)
+				}
+				task.Duration = s.Duration
+				if override.Duration > 0 {
+					task.Duration = override.Duration
+				}
+				task.Deadline = task.StartDatetime.Add(task.Duration).Add(s.Window)
+				if err := scheduleTask(task, "change"); err != nil {
+					return withSuggestions(err, *task)
+				}
+			case task.Status == "cancel" && !override.Skip: // expand again, e.g. skipped before
+				delete(s.Occurrences, key)
+			}
+		}
+		expandSeries(s, clock.Now())
+		resp, err = json.Marshal(inRequestLocation(r, newSeriesResp(s)))
+		return err
+	}
+	if isDryRun(r) {
+		writeSeriesDryRun(w, r, apply, &resp, seriesID)
+		return
+	}
+	err = engine.Update(apply)
+	if err != nil {
+		updateError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	log.Info(fmt.Sprintf("Changed occurrence %v of series %s", occurrence, seriesID))
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpandCronSeriesFromStart(t *testing.T) {
+	testClock := setupState(t, "dev1")
+	start := testClock.Now().Add(48 * time.Hour)
+	s := &Series{
+		ID:            "s",
+		Name:          "nightly",
+		Cron:          "0 3 * * *",
+		StartDatetime: start,
+		Duration:      time.Hour,
+		Zones:         []string{"dev1"},
+		Type:          "auto",
+		Status:        "active",
+		Overrides:     make(map[string]Override),
+		Occurrences:   make(map[string]string),
+	}
+	recurringSeries[s.ID] = s
+	expandSeries(s, testClock.Now())
+
+	if len(s.Occurrences) == 0 {
+		t.Fatal("no occurrences expanded")
+	}
+	for key, taskID := range s.Occurrences {
+		if occurrence := tasks[taskID].Occurrence; occurrence.Before(start) {
+			t.Errorf("occurrence %s before the series start %v", key, start)
+		}
+	}
+}
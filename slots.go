@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// FreeSlot is an interval in which a task of the requested duration can be placed at any start
+type FreeSlot struct {
+	Start time.Time
+	End   time.Time
+}
+
+// expandZones replaces zone groups from config with their zones keeping the order and dropping repeats
+func expandZones(names []string) []string {
+	zones := []string{}
+	for _, name := range names {
+		group, ok := config.ZoneGroups[name]
+		if !ok {
+			group = []string{name}
+		}
+		for _, zone := range group {
+			if !containsString(zones, zone) {
+				zones = append(zones, zone)
+			}
+		}
+	}
+	return zones
+}
+
+// slotFits tells if the dummy task can start at start in its zone like availableTimeZone and availablePrioritizedTimespan do
+func slotFits(dummyTask Task, start time.Time) bool {
+	dummyTask.StartDatetime = start
+	if err := availableTimeZone(&dummyTask); err != nil {
+		return false
+	}
+	_, err := availablePrioritizedTimespan(&dummyTask, dummyTask.Zones[0])
+	return err == nil
+}
+
+// freeSlots lists maximal intervals within from-to in which the dummy task fits in the zone at every start;
+// feasibility only changes at starts and ends of tasks, windows and freezes, so it is checked at these points
+// (shifted back by the duration too) and between them
+func freeSlots(dummyTask Task, zone string, from time.Time, to time.Time) []FreeSlot {
+	dummyTask.Zones = []string{zone}
+	latestStart := to.Add(-dummyTask.Duration)
+	if latestStart.Before(from) {
+		return []FreeSlot{}
+	}
+	points := []time.Time{from, latestStart}
+	for _, point := range pointsOfInterestTime([]time.Time{from, to}) {
+		for _, start := range []time.Time{point, point.Add(-dummyTask.Duration), point.Add(-dummyTask.Duration - config.Pauses[zone])} {
+			if start.After(from) && start.Before(latestStart) {
+				points = append(points, start)
+			}
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].Before(points[j])
+	})
+	points = removeDuplicateTime(points)
+
+	// a slot opened or extended by a stretch between points excludes that point: the task only fits after or before it
+	type startSlot struct {
+		FreeSlot
+		openStart bool
+		openEnd   bool
+	}
+	slots := []startSlot{}
+	var open *startSlot // slot of feasible starts being extended
+	extend := func(start time.Time, end time.Time, fits bool) {
+		stretch := end.After(start)
+		switch {
+		case fits && open == nil:
+			open = &startSlot{FreeSlot: FreeSlot{Start: start, End: end}, openStart: stretch, openEnd: stretch}
+		case fits:
+			open.End, open.openEnd = end, stretch
+		case open != nil:
+			slots = append(slots, *open)
+			open = nil
+		}
+	}
+	for i, point := range points {
+		extend(point, point, slotFits(dummyTask, point))
+		if i+1 < len(points) {
+			next := points[i+1]
+			extend(point, next, slotFits(dummyTask, point.Add(next.Sub(point)/2)))
+		}
+	}
+	extend(latestStart, latestStart, false)
+
+	// slots of starts become intervals the task occupies; starts are rounded like when adding tasks
+	freeSlots := []FreeSlot{}
+	for _, slot := range slots {
+		start, end := roundStart(dummyTask.Type, slot.Start), roundStartDown(dummyTask.Type, slot.End)
+		if slot.openStart && start.Equal(slot.Start) {
+			start = roundStart(dummyTask.Type, slot.Start.Add(time.Nanosecond))
+		}
+		if slot.openEnd && end.Equal(slot.End) {
+			end = roundStartDown(dummyTask.Type, slot.End.Add(-time.Nanosecond))
+		}
+		if start.After(end) {
+			continue
+		}
+		freeSlots = append(freeSlots, FreeSlot{Start: start, End: end.Add(dummyTask.Duration)})
+	}
+	return freeSlots
+}
+
+func showFreeSlots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	query := r.URL.Query()
+	duration, err := time.ParseDuration(query.Get("duration"))
+	if err != nil || duration <= 0 {
+		writeError(w, http.StatusBadRequest, newAPIError(codeInvalidRequest, "invalid duration: %s", query.Get("duration")))
+		return
+	}
+	taskType := query.Get("type")
+	if taskType == "" {
+		taskType = "manual"
+	}
+	if taskType != "auto" && taskType != "manual" {
+		writeError(w, http.StatusBadRequest, newAPIError(codeInvalidRequest, "unknown type of task"))
+		return
+	}
+	critical := false
+	if criticalParam := query.Get("critical"); criticalParam != "" {
+		critical, err = strconv.ParseBool(criticalParam)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, newAPIError(codeInvalidRequest, "invalid critical: %s", criticalParam))
+			return
+		}
+	}
+	preempt := false
+	if preemptParam := query.Get("preempt"); preemptParam != "" {
+		preempt, err = strconv.ParseBool(preemptParam)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, newAPIError(codeInvalidRequest, "invalid preempt: %s", preemptParam))
+			return
+		}
+	}
+	from := clock.Now()
+	if fromParam := query.Get("from"); fromParam != "" {
+		from, err = parseQueryTime(fromParam, requestLocation(r))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, newAPIError(codeInvalidRequest, "invalid from: %s", fromParam))
+			return
+		}
+	}
+	if from.Before(clock.Now()) {
+		from = clock.Now()
+	}
+	var to time.Time
+	toParam := query.Get("to")
+	if toParam != "" {
+		to, err = parseQueryTime(toParam, requestLocation(r))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, newAPIError(codeInvalidRequest, "invalid to: %s", toParam))
+			return
+		}
+	}
+
+	// lower-priority tasks only leave room if they may be displaced
+	dummyTask := Task{Duration: duration, Type: taskType, Critical: critical, Priority: priorityRule(taskType, critical), Status: "wait"}
+	if !preempt {
+		dummyTask.Priority = math.MaxInt32
+	}
+	var resp FreeSlotsResp
+	var zones []string
+	// zones, zone groups and the default horizon come from config, which a reload replaces
+	engine.View(func() {
+		zones = expandZones(splitParam(query.Get("zones")))
+		if len(zones) == 0 {
+			err = newAPIError(codeInvalidRequest, "zones or zone groups should be given")
+			return
+		}
+		for _, zone := range zones {
+			if _, ok := config.WhiteList[zone]; !ok && !containsString(config.BlackList, zone) {
+				err = &APIError{Code: codeUnknownZone, Message: fmt.Sprintf("no such zone or zone group exists in config: %s", zone), Zone: zone}
+				return
+			}
+		}
+		// no deadline can be later, and longer ranges would walk every whitelist day under the lock
+		if horizon := clock.Now().Add(durations.DeadlineDuration); toParam == "" || to.After(horizon) {
+			to = horizon
+		}
+		resp = FreeSlotsResp{Duration: duration, From: from, To: to, Zones: make(map[string][]FreeSlot)}
+		for _, zone := range zones {
+			resp.Zones[zone] = freeSlots(dummyTask, zone, from, to)
+		}
+	})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	json.NewEncoder(w).Encode(inRequestLocation(r, resp))
+	log.Debug("Searched free slots in zones ", zones)
+}
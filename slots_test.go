@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestShowFreeSlotsClampsTo(t *testing.T) {
+	setupState(t, "dev1")
+	w := httptest.NewRecorder()
+	showFreeSlots(w, httptest.NewRequest("GET", "/slots?duration=1h&zones=dev1&to=87600h", nil))
+	var resp FreeSlotsResp
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response %d %s: %v", w.Code, w.Body.String(), err)
+	}
+	if horizon := testStart.Add(durations.DeadlineDuration); !resp.To.Equal(horizon) {
+		t.Fatalf("searched up to %v, want %v", resp.To, horizon)
+	}
+	slots := resp.Zones["dev1"]
+	if len(slots) == 0 || slots[len(slots)-1].End.After(resp.To.Add(time.Hour)) {
+		t.Fatalf("slots %v end after the horizon", slots)
+	}
+}
+
+func TestFreeSlots(t *testing.T) {
+	// dev1 is open 08:00-12:00 with a 5m pause after tasks; a manual task takes 09:00-10:00
+	at := func(clock string) time.Time {
+		parsed, err := time.Parse("15:04", clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return testStart.Add(time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute)
+	}
+	cases := []struct {
+		name  string
+		task  Task
+		from  string
+		to    string
+		slots [][2]string
+	}{
+		{
+			// the task only has to overlap the window; it may end right at the start of the blocking task,
+			// but starts only after its pause
+			name:  "around a blocking task",
+			task:  Task{Duration: 30 * time.Minute, Type: "auto", Priority: math.MaxInt32},
+			from:  "00:00",
+			to:    "23:59",
+			slots: [][2]string{{"07:31", "09:00"}, {"10:05", "12:29"}},
+		},
+		{
+			name:  "within from-to",
+			task:  Task{Duration: 30 * time.Minute, Type: "auto", Priority: math.MaxInt32},
+			from:  "08:10",
+			to:    "10:50",
+			slots: [][2]string{{"08:10", "09:00"}, {"10:05", "10:50"}},
+		},
+		{
+			name:  "longer task",
+			task:  Task{Duration: 2 * time.Hour, Type: "auto", Priority: math.MaxInt32},
+			from:  "00:00",
+			to:    "23:59",
+			slots: [][2]string{{"06:01", "09:00"}, {"10:05", "13:59"}},
+		},
+		{
+			// manual starts are multiples of 5m; a critical task displaces the manual one
+			name:  "displacing with rounded starts",
+			task:  Task{Duration: 30 * time.Minute, Type: "manual", Critical: true, Priority: 0},
+			from:  "00:00",
+			to:    "23:59",
+			slots: [][2]string{{"07:35", "12:25"}},
+		},
+		{
+			name:  "longer than from-to",
+			task:  Task{Duration: 3 * time.Hour, Type: "auto", Priority: math.MaxInt32},
+			from:  "10:00",
+			to:    "12:00",
+			slots: [][2]string{},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			setupState(t, "dev1")
+			config.WhiteListRaw["dev1"] = []string{"08:00-12:00"}
+			if err := loadWhiteList(); err != nil {
+				t.Fatal(err)
+			}
+			placeTestTask(newTestTask("a", "manual", at("09:00"), time.Hour, "dev1"))
+			c.task.Status = "wait"
+			got := freeSlots(c.task, "dev1", at(c.from), at(c.to))
+			want := []FreeSlot{}
+			for _, slot := range c.slots {
+				want = append(want, FreeSlot{Start: at(slot[0]), End: at(slot[1])})
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("slots are %v, want %v", got, want)
+			}
+		})
+	}
+}
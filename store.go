@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// State is everything the scheduler needs to survive a restart
+type State struct {
+	Tasks    map[string]*Task
+	Schedule map[string][]string // task IDs by zone ordered by start; zone indexes are rebuilt on load
+	Series   map[string]*Series
+	Freezes  map[string]*Freeze
+	Reports  map[string]*ReloadReport
+}
+
+type Store interface {
+	Load() (State, error)
+	Save(state State) error
+	Close() error
+}
+
+var store Store = &memoryStore{}
+
+func persistState() error {
+	return store.Save(State{Tasks: tasks, Schedule: scheduleTaskIDs(), Series: recurringSeries, Freezes: freezes, Reports: reloadReports})
+}
+
+func newStore(dataDir string) (Store, error) {
+	if dataDir == "" {
+		return &memoryStore{}, nil
+	}
+	return openFileStore(dataDir, 1000)
+}
+
+// memoryStore keeps nothing; used when no data directory is configured
+type memoryStore struct{}
+
+func (s *memoryStore) Load() (State, error) {
+	return State{Tasks: make(map[string]*Task), Schedule: make(map[string][]string), Series: make(map[string]*Series), Freezes: make(map[string]*Freeze), Reports: make(map[string]*ReloadReport)}, nil
+}
+
+func (s *memoryStore) Save(state State) error {
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+// state is flattened into records keyed by "kind/id"; the journal only carries records changed since the last save
+const (
+	taskRecord   = "task/"
+	zoneRecord   = "zone/"
+	seriesRecord = "series/"
+	freezeRecord = "freeze/"
+	reportRecord = "report/"
+)
+
+func stateRecords(state State) (map[string]json.RawMessage, error) {
+	records := make(map[string]json.RawMessage)
+	for taskID, task := range state.Tasks {
+		raw, err := json.Marshal(task)
+		if err != nil {
+			return nil, err
+		}
+		records[taskRecord+taskID] = raw
+	}
+	for zone, scheduleZone := range state.Schedule {
+		raw, err := json.Marshal(scheduleZone)
+		if err != nil {
+			return nil, err
+		}
+		records[zoneRecord+zone] = raw
+	}
+	for seriesID, s := range state.Series {
+		raw, err := json.Marshal(s)
+		if err != nil {
+			return nil, err
+		}
+		records[seriesRecord+seriesID] = raw
+	}
+	for freezeID, freeze := range state.Freezes {
+		raw, err := json.Marshal(freeze)
+		if err != nil {
+			return nil, err
+		}
+		records[freezeRecord+freezeID] = raw
+	}
+	for reportID, report := range state.Reports {
+		raw, err := json.Marshal(report)
+		if err != nil {
+			return nil, err
+		}
+		records[reportRecord+reportID] = raw
+	}
+	return records, nil
+}
+
+func recordsState(records map[string]json.RawMessage) (State, error) {
+	state := State{Tasks: make(map[string]*Task), Schedule: make(map[string][]string), Series: make(map[string]*Series), Freezes: make(map[string]*Freeze), Reports: make(map[string]*ReloadReport)}
+	for key, raw := range records {
+		switch {
+		case strings.HasPrefix(key, taskRecord):
+			var task Task
+			if err := json.Unmarshal(raw, &task); err != nil {
+				return state, fmt.Errorf("record %s: %w", key, err)
+			}
+			state.Tasks[strings.TrimPrefix(key, taskRecord)] = &task
+		case strings.HasPrefix(key, zoneRecord):
+			var scheduleZone []string
+			if err := json.Unmarshal(raw, &scheduleZone); err != nil {
+				return state, fmt.Errorf("record %s: %w", key, err)
+			}
+			state.Schedule[strings.TrimPrefix(key, zoneRecord)] = scheduleZone
+		case strings.HasPrefix(key, seriesRecord):
+			var s Series
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return state, fmt.Errorf("record %s: %w", key, err)
+			}
+			state.Series[strings.TrimPrefix(key, seriesRecord)] = &s
+		case strings.HasPrefix(key, freezeRecord):
+			var freeze Freeze
+			if err := json.Unmarshal(raw, &freeze); err != nil {
+				return state, fmt.Errorf("record %s: %w", key, err)
+			}
+			state.Freezes[strings.TrimPrefix(key, freezeRecord)] = &freeze
+		case strings.HasPrefix(key, reportRecord):
+			var report ReloadReport
+			if err := json.Unmarshal(raw, &report); err != nil {
+				return state, fmt.Errorf("record %s: %w", key, err)
+			}
+			state.Reports[strings.TrimPrefix(key, reportRecord)] = &report
+		default:
+			log.Warn("Skipping unknown record ", key)
+		}
+	}
+	return state, nil
+}
+
+// journalEntry is one committed change; a single line per save keeps replay atomic
+type journalEntry struct {
+	Seq     int64
+	Puts    map[string]json.RawMessage `json:",omitempty"`
+	Deletes []string                   `json:",omitempty"`
+}
+
+// fileStore is a snapshot file plus an append-only journal compacted into the snapshot every compactEvery entries
+type fileStore struct {
+	dir          string
+	journal      *os.File
+	records      map[string]json.RawMessage
+	seq          int64
+	entries      int
+	compactEvery int
+}
+
+func openFileStore(dir string, compactEvery int) (*fileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("store error: %w", err)
+	}
+	s := &fileStore{
+		dir:          dir,
+		records:      make(map[string]json.RawMessage),
+		compactEvery: compactEvery,
+	}
+	return s, nil
+}
+
+func (s *fileStore) snapshotPath() string {
+	return filepath.Join(s.dir, "snapshot.json")
+}
+
+func (s *fileStore) journalPath() string {
+	return filepath.Join(s.dir, "journal.jsonl")
+}
+
+type snapshotFile struct {
+	Seq     int64
+	Records map[string]json.RawMessage
+}
+
+func (s *fileStore) Load() (State, error) {
+	raw, err := os.ReadFile(s.snapshotPath())
+	if err != nil && !os.IsNotExist(err) {
+		return State{}, fmt.Errorf("store error: %w", err)
+	}
+	if err == nil {
+		var snapshot snapshotFile
+		if err := json.Unmarshal(raw, &snapshot); err != nil {
+			return State{}, fmt.Errorf("store error: corrupted snapshot: %w", err)
+		}
+		s.seq = snapshot.Seq
+		if snapshot.Records != nil {
+			s.records = snapshot.Records
+		}
+	}
+
+	journal, err := os.OpenFile(s.journalPath(), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return State{}, fmt.Errorf("store error: %w", err)
+	}
+	valid := int64(0)
+	reader := bufio.NewReader(journal)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil {
+			if len(bytes.TrimSpace(line)) > 0 {
+				log.Warn("Dropping incomplete journal entry at offset ", valid)
+			}
+			break
+		}
+		var entry journalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			log.Warn("Dropping corrupted journal entry at offset ", valid)
+			break
+		}
+		valid += int64(len(line))
+		if entry.Seq <= s.seq { // already in snapshot
+			continue
+		}
+		s.apply(entry)
+		s.entries++
+	}
+	// cut off a torn tail so new entries are appended after the last good one
+	if err := journal.Truncate(valid); err != nil {
+		journal.Close()
+		return State{}, fmt.Errorf("store error: %w", err)
+	}
+	if _, err := journal.Seek(valid, 0); err != nil {
+		journal.Close()
+		return State{}, fmt.Errorf("store error: %w", err)
+	}
+	s.journal = journal
+	log.Info(fmt.Sprintf("Loaded %d records from %s (%d journal entries replayed)", len(s.records), s.dir, s.entries))
+	return recordsState(s.records)
+}
+
+func (s *fileStore) apply(entry journalEntry) {
+	for key, raw := range entry.Puts {
+		s.records[key] = raw
+	}
+	for _, key := range entry.Deletes {
+		delete(s.records, key)
+	}
+	s.seq = entry.Seq
+}
+
+func (s *fileStore) Save(state State) error {
+	if s.journal == nil {
+		return fmt.Errorf("store error: store is not loaded")
+	}
+	records, err := stateRecords(state)
+	if err != nil {
+		return fmt.Errorf("store error: %w", err)
+	}
+	entry := journalEntry{Seq: s.seq + 1, Puts: make(map[string]json.RawMessage)}
+	for key, raw := range records {
+		if old, ok := s.records[key]; !ok || !bytes.Equal(old, raw) {
+			entry.Puts[key] = raw
+		}
+	}
+	for key := range s.records {
+		if _, ok := records[key]; !ok {
+			entry.Deletes = append(entry.Deletes, key)
+		}
+	}
+	if len(entry.Puts) == 0 && len(entry.Deletes) == 0 {
+		return nil
+	}
+	sort.Strings(entry.Deletes)
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("store error: %w", err)
+	}
+	if _, err := s.journal.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("store error: %w", err)
+	}
+	if err := s.journal.Sync(); err != nil {
+		return fmt.Errorf("store error: %w", err)
+	}
+	s.apply(entry)
+	s.entries++
+	if s.entries >= s.compactEvery {
+		return s.compact()
+	}
+	return nil
+}
+
+func (s *fileStore) compact() error {
+	raw, err := json.Marshal(snapshotFile{Seq: s.seq, Records: s.records})
+	if err != nil {
+		return fmt.Errorf("store error: %w", err)
+	}
+	tmpPath := s.snapshotPath() + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("store error: %w", err)
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return fmt.Errorf("store error: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("store error: %w", err)
+	}
+	tmp.Close()
+	if err := os.Rename(tmpPath, s.snapshotPath()); err != nil {
+		return fmt.Errorf("store error: %w", err)
+	}
+	// journal entries up to seq are in the snapshot now and are skipped on replay even if truncation fails
+	if err := s.journal.Truncate(0); err != nil {
+		return fmt.Errorf("store error: %w", err)
+	}
+	if _, err := s.journal.Seek(0, 0); err != nil {
+		return fmt.Errorf("store error: %w", err)
+	}
+	s.entries = 0
+	log.Debug("Compacted journal into snapshot at seq ", s.seq)
+	return nil
+}
+
+func (s *fileStore) Close() error {
+	if s.journal == nil {
+		return nil
+	}
+	err := s.journal.Close()
+	s.journal = nil
+	return err
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func currentState() State {
+	return State{Tasks: tasks, Schedule: scheduleTaskIDs(), Series: recurringSeries, Freezes: freezes, Reports: reloadReports}
+}
+
+// reopenStore closes the store and loads its directory into a new one
+func reopenStore(t *testing.T, s *fileStore, compactEvery int) (*fileStore, State) {
+	t.Helper()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := openFileStore(s.dir, compactEvery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := reopened.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { reopened.Close() })
+	return reopened, loaded
+}
+
+// assertSameState compares states by their records, as they are persisted
+func assertSameState(t *testing.T, got State, want State) {
+	t.Helper()
+	gotRecords, err := stateRecords(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRecords, err := stateRecords(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotRecords, wantRecords) {
+		t.Fatalf("loaded %d records, want %d:\n%v\nwant\n%v", len(gotRecords), len(wantRecords), gotRecords, wantRecords)
+	}
+}
+
+func loadedFileStore(t *testing.T, compactEvery int) *fileStore {
+	t.Helper()
+	s, err := openFileStore(t.TempDir(), compactEvery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestFileStoreReopens(t *testing.T) {
+	setupState(t, "dev1", "dev2")
+	s := loadedFileStore(t, 1000)
+	placeTestTask(newTestTask("a", "auto", testStart.Add(time.Hour), 30*time.Minute, "dev1", "dev2"))
+	placeTestTask(newTestTask("b", "manual", testStart.Add(2*time.Hour), time.Hour, "dev2"))
+	freezes["f"] = &Freeze{ID: "f", Name: "release", Start: testStart, End: testStart.Add(time.Hour), Source: "api"}
+	if err := s.Save(currentState()); err != nil {
+		t.Fatal(err)
+	}
+	// the second entry deletes a task and a freeze and changes another task
+	cancelTask("a")
+	delete(tasks, "a")
+	delete(freezes, "f")
+	tasks["b"].Result = "done"
+	if err := s.Save(currentState()); err != nil {
+		t.Fatal(err)
+	}
+
+	_, loaded := reopenStore(t, s, 1000)
+	assertSameState(t, loaded, currentState())
+	if _, ok := loaded.Tasks["a"]; ok {
+		t.Fatal("deleted task is loaded")
+	}
+}
+
+func TestFileStoreDropsTornJournalTail(t *testing.T) {
+	setupState(t, "dev1")
+	s := loadedFileStore(t, 1000)
+	placeTestTask(newTestTask("a", "auto", testStart.Add(time.Hour), 30*time.Minute, "dev1"))
+	if err := s.Save(currentState()); err != nil {
+		t.Fatal(err)
+	}
+	placeTestTask(newTestTask("b", "auto", testStart.Add(2*time.Hour), 30*time.Minute, "dev1"))
+	if err := s.Save(currentState()); err != nil {
+		t.Fatal(err)
+	}
+	saved := currentState()
+	journal, err := os.OpenFile(s.journalPath(), os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := journal.WriteString(`{"Seq":3,"Puts":{"task/c":{"ID":"c","Na`); err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+
+	s, loaded := reopenStore(t, s, 1000)
+	assertSameState(t, loaded, saved)
+	if s.entries != 2 {
+		t.Fatalf("replayed %d journal entries, want 2", s.entries)
+	}
+
+	// entries saved after the torn tail is cut off are replayed too
+	placeTestTask(newTestTask("c", "auto", testStart.Add(3*time.Hour), 30*time.Minute, "dev1"))
+	if err := s.Save(currentState()); err != nil {
+		t.Fatal(err)
+	}
+	_, loaded = reopenStore(t, s, 1000)
+	assertSameState(t, loaded, currentState())
+}
+
+func TestFileStoreCompactsJournal(t *testing.T) {
+	setupState(t, "dev1")
+	s := loadedFileStore(t, 1000)
+	task := newTestTask("a", "auto", testStart.Add(time.Hour), 30*time.Minute, "dev1")
+	placeTestTask(task)
+	for i := 0; i < 1000; i++ {
+		task.Progress = i % 100
+		task.Revision = i
+		if err := s.Save(currentState()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(s.snapshotPath()); err != nil {
+		t.Fatalf("no snapshot after 1000 journal entries: %v", err)
+	}
+	if info, err := os.Stat(s.journalPath()); err != nil || info.Size() != 0 {
+		t.Fatalf("journal isn't truncated after compaction: %v %v", info, err)
+	}
+	if s.entries != 0 || s.seq != 1000 {
+		t.Fatalf("store at seq %d with %d entries, want seq 1000 with none", s.seq, s.entries)
+	}
+
+	// the snapshot is loaded with the entries journaled after it
+	placeTestTask(newTestTask("b", "auto", testStart.Add(2*time.Hour), 30*time.Minute, "dev1"))
+	if err := s.Save(currentState()); err != nil {
+		t.Fatal(err)
+	}
+	s, loaded := reopenStore(t, s, 1000)
+	assertSameState(t, loaded, currentState())
+	if s.seq != 1001 || s.entries != 1 {
+		t.Fatalf("reopened at seq %d with %d entries replayed, want seq 1001 with 1", s.seq, s.entries)
+	}
+}
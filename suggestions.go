@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultSuggestionsCount = 5
+
+// candidatePoints are rounded start times to try for the task, from its start up to its deadline
+func candidatePoints(task Task) []time.Time {
+	earliest, err := earliestStart(task)
+	if err != nil {
+		return nil
+	}
+	addPoints := []time.Time{task.StartDatetime}
+	if task.PreferredStartDatetime.After(task.StartDatetime) {
+		addPoints = append(addPoints, task.PreferredStartDatetime)
+	}
+	if earliest.After(task.StartDatetime) {
+		addPoints = append(addPoints, earliest)
+	}
+	for _, zone := range task.Zones {
+		addPoints = append(addPoints, task.StartDatetime.Add(task.Duration).Add(config.Pauses[zone]))
+	}
+	points := []time.Time{}
+	for _, point := range pointsOfInterestTime(addPoints) {
+		point = roundStart(task.Type, point)
+		if point.Before(task.StartDatetime) || point.Before(earliest) {
+			continue
+		}
+		if point.Add(task.Duration).After(task.Deadline) {
+			break
+		}
+		points = append(points, point)
+	}
+	return removeDuplicateTime(points)
+}
+
+func newSlotCandidate(task Task, zones []string, start time.Time, displaced []string) SlotCandidate {
+	distance := start.Sub(task.PreferredStartDatetime)
+	if distance < 0 {
+		distance = -distance
+	}
+	return SlotCandidate{
+		Zones:                 zones,
+		StartDatetime:         start,
+		EndDatetime:           start.Add(task.Duration),
+		Displaced:             displaced,
+		DistanceFromPreferred: distance,
+		DeadlineSlack:         task.Deadline.Sub(start.Add(task.Duration)),
+	}
+}
+
+// zoneCandidates lists every feasible start of the task in one zone; read-only
+func zoneCandidates(task Task, zone string, points []time.Time) []SlotCandidate {
+	candidates := []SlotCandidate{}
+	dummyTask := task.clone()
+	dummyTask.Zones = []string{zone}
+	for _, point := range points {
+		dummyTask.StartDatetime = point
+		if err := availableTimeZone(&dummyTask); err != nil {
+			continue
+		}
+		order, err := availablePrioritizedTimespan(&dummyTask, zone)
+		if err != nil {
+			continue
+		}
+		candidates = append(candidates, newSlotCandidate(task, []string{zone}, point, order.reschedTaskIds))
+	}
+	return candidates
+}
+
+// alignedCandidates lists starts at which the task fits in all its zones at once; read-only
+func alignedCandidates(task Task, points []time.Time) []SlotCandidate {
+	candidates := []SlotCandidate{}
+	dummyTask := task.clone()
+	for _, point := range points {
+		dummyTask.StartDatetime = point
+		if err := availableTimeZone(&dummyTask); err != nil {
+			continue
+		}
+		displaced := []string{}
+		seen := make(map[string]bool)
+		feasible := true
+		for _, zone := range task.Zones {
+			order, err := availablePrioritizedTimespan(&dummyTask, zone)
+			if err != nil {
+				feasible = false
+				break
+			}
+			for _, taskID := range order.reschedTaskIds {
+				if !seen[taskID] {
+					seen[taskID] = true
+					displaced = append(displaced, taskID)
+				}
+			}
+		}
+		if feasible {
+			candidates = append(candidates, newSlotCandidate(task, task.Zones, point, displaced))
+		}
+	}
+	return candidates
+}
+
+// rankCandidates orders by distance from preferred start, then number of displaced tasks, then the largest deadline slack
+func rankCandidates(candidates []SlotCandidate, count int) []SlotCandidate {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].DistanceFromPreferred != candidates[j].DistanceFromPreferred {
+			return candidates[i].DistanceFromPreferred < candidates[j].DistanceFromPreferred
+		}
+		if len(candidates[i].Displaced) != len(candidates[j].Displaced) {
+			return len(candidates[i].Displaced) < len(candidates[j].Displaced)
+		}
+		return candidates[i].DeadlineSlack > candidates[j].DeadlineSlack
+	})
+	if len(candidates) > count {
+		candidates = candidates[:count]
+	}
+	return candidates
+}
+
+func suggestSlots(task Task, count int) SuggestionsResp {
+	resp := SuggestionsResp{Zones: make(map[string][]SlotCandidate)}
+	points := candidatePoints(task)
+	for _, zone := range task.Zones {
+		resp.Zones[zone] = rankCandidates(zoneCandidates(task, zone, points), count)
+	}
+	resp.Aligned = rankCandidates(alignedCandidates(task, points), count)
+	return resp
+}
+
+func suggestionsReqFromQuery(r *http.Request) (SuggestionsReq, error) {
+	query := r.URL.Query()
+	suggestionsReq := SuggestionsReq{
+		AddTaskReq: AddTaskReq{
+			Name:                   query.Get("name"),
+			StartDatetime:          query.Get("start"),
+			PreferredStartDatetime: query.Get("preferred"),
+			Duration:               query.Get("duration"),
+			Deadline:               query.Get("deadline"),
+			Type:                   query.Get("type"),
+		},
+	}
+	if zones := query.Get("zones"); zones != "" {
+		suggestionsReq.Zones = strings.Split(zones, ",")
+	}
+	var err error
+	if critical := query.Get("critical"); critical != "" {
+		suggestionsReq.Critical, err = strconv.ParseBool(critical)
+		if err != nil {
+			return suggestionsReq, newAPIError(codeInvalidRequest, "invalid critical: %s", critical)
+		}
+	}
+	if compression := query.Get("compression"); compression != "" {
+		suggestionsReq.CompressionPerc, err = strconv.Atoi(compression)
+		if err != nil {
+			return suggestionsReq, newAPIError(codeInvalidRequest, "invalid compression: %s", compression)
+		}
+	}
+	if count := query.Get("count"); count != "" {
+		suggestionsReq.Count, err = strconv.Atoi(count)
+		if err != nil {
+			return suggestionsReq, newAPIError(codeInvalidRequest, "invalid count: %s", count)
+		}
+	}
+	return suggestionsReq, nil
+}
+
+func showSuggestions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	var suggestionsReq SuggestionsReq
+	var err error
+	if r.Method == http.MethodGet {
+		suggestionsReq, err = suggestionsReqFromQuery(r)
+	} else {
+		var reqBody []byte
+		reqBody, err = ioutil.ReadAll(r.Body)
+		json.Unmarshal(reqBody, &suggestionsReq)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		log.Warn(err)
+		return
+	}
+	count := suggestionsReq.Count
+	if count <= 0 {
+		count = defaultSuggestionsCount
+	}
+
+	task, err := taskFromReq(suggestionsReq.AddTaskReq, requestLocation(r))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		log.Warn(err)
+		return
+	}
+	var resp SuggestionsResp
+	engine.View(func() {
+		resp = suggestSlots(task, count)
+	})
+	json.NewEncoder(w).Encode(inRequestLocation(r, resp))
+}
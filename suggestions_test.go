@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRankCandidates(t *testing.T) {
+	candidate := func(id string, distance time.Duration, displaced int, slack time.Duration) SlotCandidate {
+		return SlotCandidate{
+			Zones:                 []string{id},
+			Displaced:             make([]string, displaced),
+			DistanceFromPreferred: distance,
+			DeadlineSlack:         slack,
+		}
+	}
+	candidates := []SlotCandidate{
+		candidate("far", 2*time.Hour, 0, 6*time.Hour),
+		candidate("displacing", 30*time.Minute, 1, 5*time.Hour),
+		candidate("less slack", 30*time.Minute, 0, 3*time.Hour),
+		candidate("more slack", 30*time.Minute, 0, 4*time.Hour),
+		candidate("preferred", 0, 2, time.Hour),
+	}
+	want := []string{"preferred", "more slack", "less slack", "displacing", "far"}
+	for count := 1; count <= len(want)+1; count++ {
+		ranked := rankCandidates(append([]SlotCandidate{}, candidates...), count)
+		got := []string{}
+		for _, c := range ranked {
+			got = append(got, c.Zones[0])
+		}
+		top := want
+		if count < len(want) {
+			top = want[:count]
+		}
+		if !reflect.DeepEqual(got, top) {
+			t.Fatalf("top %d are %v, want %v", count, got, top)
+		}
+	}
+}
+
+func TestSuggestSlots(t *testing.T) {
+	// an auto task in dev1 can be displaced by the manual task, the manual one in dev2 can't
+	setupState(t, "dev1", "dev2")
+	placeTestTask(newTestTask("x", "auto", testStart.Add(3*time.Hour), time.Hour, "dev1"))
+	placeTestTask(newTestTask("y", "manual", testStart.Add(2*time.Hour+30*time.Minute), time.Hour, "dev2"))
+	task := newTestTask("new", "manual", testStart.Add(time.Hour), time.Hour, "dev1", "dev2")
+	task.PreferredStartDatetime = testStart.Add(3 * time.Hour)
+	task.Deadline = testStart.Add(8 * time.Hour)
+	before := snapshotState()
+
+	resp := suggestSlots(*task, 5)
+	type slot struct {
+		start     string
+		displaced []string
+	}
+	slots := func(candidates []SlotCandidate) []slot {
+		got := []slot{}
+		for _, c := range candidates {
+			got = append(got, slot{c.StartDatetime.Format("15:04"), c.Displaced})
+		}
+		return got
+	}
+	cases := []struct {
+		name       string
+		candidates []SlotCandidate
+		want       []slot
+	}{
+		// closest to the preferred start first; every start before the auto task ends displaces it
+		{name: "dev1", candidates: resp.Zones["dev1"], want: []slot{{"03:00", []string{"x"}}, {"02:30", []string{"x"}}, {"03:35", []string{"x"}}, {"02:05", []string{"x"}}, {"04:05", []string{}}}},
+		{name: "dev2", candidates: resp.Zones["dev2"], want: []slot{{"03:35", []string{}}, {"04:05", []string{}}, {"01:00", []string{}}}},
+		{name: "aligned", candidates: resp.Aligned, want: []slot{{"03:35", []string{"x"}}, {"04:05", []string{}}, {"01:00", []string{}}}},
+	}
+	for _, c := range cases {
+		if got := slots(c.candidates); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s slots are %v, want %v", c.name, got, c.want)
+		}
+	}
+	if top := resp.Zones["dev1"][0]; top.DistanceFromPreferred != 0 || top.DeadlineSlack != 4*time.Hour || !top.EndDatetime.Equal(testStart.Add(4*time.Hour)) {
+		t.Errorf("top dev1 slot is %+v", top)
+	}
+	if !reflect.DeepEqual(taskStarts(), map[string]time.Time{"x": before.tasks["x"].StartDatetime, "y": before.tasks["y"].StartDatetime}) {
+		t.Errorf("suggesting slots changed the schedule: %v", taskStarts())
+	}
+
+	w := httptest.NewRecorder()
+	showSuggestions(w, httptest.NewRequest("GET", "/suggestions?name=new&type=manual&zones=dev1,dev2&duration=1h&start=07/01/2030+01:00&preferred=07/01/2030+03:00&deadline=07/01/2030+08:00&count=2", nil))
+	var handlerResp SuggestionsResp
+	if err := json.Unmarshal(w.Body.Bytes(), &handlerResp); err != nil {
+		t.Fatalf("response %d %s: %v", w.Code, w.Body.String(), err)
+	}
+	if got := slots(handlerResp.Zones["dev1"]); !reflect.DeepEqual(got, cases[0].want[:2]) {
+		t.Errorf("dev1 slots with count 2 are %v, want %v", got, cases[0].want[:2])
+	}
+	if len(handlerResp.Aligned) != 2 {
+		t.Errorf("%d aligned slots with count 2", len(handlerResp.Aligned))
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+	_ "time/tzdata" // IANA timezones even if the host has no zoneinfo
+)
+
+// datetimeLayouts are accepted in requests; times without an offset are in the request timezone
+var datetimeLayouts = []string{time.RFC3339, "02/01/2006 15:04 -07:00"}
+
+// parseDatetime parses a request time in one of datetimeLayouts or "02/01/2006 15:04" in loc, the result is in UTC
+func parseDatetime(value string, loc *time.Location) (time.Time, error) {
+	for _, layout := range datetimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	t, err := time.ParseInLocation("02/01/2006 15:04", value, loc)
+	if err != nil {
+		return t, err
+	}
+	return t.UTC(), nil
+}
+
+func loadTimezones() error {
+	locations := make(map[string]*time.Location)
+	for zone, name := range config.TimezonesRaw {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return fmt.Errorf("configuration error: timezone of zone %s: %s", zone, err.Error())
+		}
+		locations[zone] = loc
+	}
+	config.Locations = locations
+	return nil
+}
+
+// zoneLocation is the timezone whitelist windows of the zone are in, UTC by default
+func zoneLocation(zone string) *time.Location {
+	if loc, ok := config.Locations[zone]; ok {
+		return loc
+	}
+	return time.UTC
+}
+
+type locationKey struct{}
+
+// requestLocation is the timezone chosen with the tz query parameter, UTC by default
+func requestLocation(r *http.Request) *time.Location {
+	if loc, ok := r.Context().Value(locationKey{}).(*time.Location); ok {
+		return loc
+	}
+	return time.UTC
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// inRequestLocation is v with its times in the request timezone, for the response body;
+// v is copied, so the state it points to keeps its times in UTC
+func inRequestLocation(r *http.Request, v interface{}) interface{} {
+	loc, ok := r.Context().Value(locationKey{}).(*time.Location)
+	if !ok || v == nil {
+		return v
+	}
+	return inLocation(reflect.ValueOf(v), loc).Interface()
+}
+
+// inLocation deep-copies v through pointers, interfaces, structs, slices and maps with every set time in loc
+func inLocation(v reflect.Value, loc *time.Location) reflect.Value {
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			// unset, would get the local mean time of loc
+			return v
+		}
+		return reflect.ValueOf(t.In(loc))
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Type().Elem())
+		copied.Elem().Set(inLocation(v.Elem(), loc))
+		return copied
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(inLocation(v.Elem(), loc))
+		return copied
+	case reflect.Struct:
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				copied.Field(i).Set(inLocation(v.Field(i), loc))
+			}
+		}
+		return copied
+	case reflect.Slice:
+		// raw JSON is marshalled by the handler already
+		if v.IsNil() || v.Type().Elem().Kind() == reflect.Uint8 {
+			return v
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(inLocation(v.Index(i), loc))
+		}
+		return copied
+	case reflect.Array:
+		copied := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(inLocation(v.Index(i), loc))
+		}
+		return copied
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			copied.SetMapIndex(iter.Key(), inLocation(iter.Value(), loc))
+		}
+		return copied
+	}
+	return v
+}
+
+// timezoneMiddleware checks the tz query parameter and passes its timezone to the handlers,
+// which parse times without an offset and render response times in it
+func timezoneMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tz := r.URL.Query().Get("tz")
+		if tz == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, newAPIError(codeInvalidRequest, "unknown timezone %s", tz))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), locationKey{}, loc)))
+	})
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInRequestLocation(t *testing.T) {
+	setupState(t, "dev1")
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/tasks?tz=Asia/Tokyo", nil)
+	r = r.WithContext(context.WithValue(r.Context(), locationKey{}, tokyo))
+	task := newTestTask("a", "manual", testStart, time.Hour, "dev1")
+	task.Name = "rollback to 2030-01-07T00:00:00Z"
+
+	localized := inRequestLocation(r, TasksPage{Total: 1, Tasks: []*Task{task}}).(TasksPage)
+	if got := localized.Tasks[0].StartDatetime; got.Location() != tokyo || !got.Equal(testStart) {
+		t.Fatalf("start in response is %v, want %v in Asia/Tokyo", got, testStart)
+	}
+	if localized.Tasks[0].Name != task.Name {
+		t.Fatalf("name in response is %q, want %q", localized.Tasks[0].Name, task.Name)
+	}
+	if task.StartDatetime.Location() != time.UTC {
+		t.Fatalf("stored start is in %v, want UTC", task.StartDatetime.Location())
+	}
+}
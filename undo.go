@@ -0,0 +1,133 @@
+package main
+
+// undoLog keeps what a scheduling attempt changed, as it was before the first change, so a failed attempt
+// is rolled back without copying all tasks and zone indexes
+type undoLog struct {
+	tasks       map[string]*Task            // nil for tasks added by the attempt
+	spans       map[string]map[string]*span // by zone and task ID, nil for tasks that weren't in the zone index
+	zones       []string                    // zone indexes created by the attempt
+	preemptions int                         // length of preemptionLog
+}
+
+// undoLogs are the attempts in progress, the innermost last; changes are recorded in the innermost one
+var undoLogs []*undoLog
+
+func beginUndo() {
+	undoLogs = append(undoLogs, &undoLog{
+		tasks:       make(map[string]*Task),
+		spans:       make(map[string]map[string]*span),
+		preemptions: len(preemptionLog),
+	})
+}
+
+func popUndo() *undoLog {
+	undo := undoLogs[len(undoLogs)-1]
+	undoLogs = undoLogs[:len(undoLogs)-1]
+	return undo
+}
+
+// recordTask keeps the task as it is before it's changed or added
+func recordTask(taskID string) {
+	if len(undoLogs) == 0 {
+		return
+	}
+	undo := undoLogs[len(undoLogs)-1]
+	if _, ok := undo.tasks[taskID]; ok {
+		return
+	}
+	undo.tasks[taskID] = nil
+	if task, ok := tasks[taskID]; ok {
+		saved := task.clone()
+		undo.tasks[taskID] = &saved
+	}
+}
+
+// recordSpan keeps the slot the zone index has for the task before it's inserted or removed
+func recordSpan(zone string, taskID string) {
+	if len(undoLogs) == 0 {
+		return
+	}
+	undo := undoLogs[len(undoLogs)-1]
+	zoneSpans, ok := undo.spans[zone]
+	if !ok {
+		zoneSpans = make(map[string]*span)
+		undo.spans[zone] = zoneSpans
+	}
+	if _, ok := zoneSpans[taskID]; ok {
+		return
+	}
+	zoneSpans[taskID] = nil
+	if zoneSchedule, ok := schedule[zone]; ok {
+		if s, ok := zoneSchedule.spans[taskID]; ok {
+			zoneSpans[taskID] = &s
+		}
+	}
+}
+
+func recordZone(zone string) {
+	if len(undoLogs) == 0 {
+		return
+	}
+	undo := undoLogs[len(undoLogs)-1]
+	undo.zones = append(undo.zones, zone)
+}
+
+// commitUndo keeps the changes of the innermost attempt; the enclosing attempt can still roll them back
+func commitUndo() {
+	committed := popUndo()
+	if len(undoLogs) == 0 {
+		return
+	}
+	undo := undoLogs[len(undoLogs)-1]
+	for taskID, task := range committed.tasks {
+		if _, ok := undo.tasks[taskID]; !ok {
+			undo.tasks[taskID] = task
+		}
+	}
+	for zone, committedSpans := range committed.spans {
+		zoneSpans, ok := undo.spans[zone]
+		if !ok {
+			undo.spans[zone] = committedSpans
+			continue
+		}
+		for taskID, s := range committedSpans {
+			if _, ok := zoneSpans[taskID]; !ok {
+				zoneSpans[taskID] = s
+			}
+		}
+	}
+	undo.zones = append(undo.zones, committed.zones...)
+}
+
+// rollbackUndo puts back tasks, zone indexes and preemptionLog as they were when the innermost attempt began
+func rollbackUndo() {
+	undo := popUndo()
+	for zone, zoneSpans := range undo.spans {
+		zoneSchedule := schedule[zone]
+		for taskID, s := range zoneSpans {
+			zoneSchedule.remove(taskID)
+			if s != nil {
+				zoneSchedule.insert(taskID, s.Start, s.End)
+			}
+		}
+	}
+	for _, zone := range undo.zones {
+		if schedule[zone].len() == 0 {
+			delete(schedule, zone)
+		}
+	}
+	for taskID, saved := range undo.tasks {
+		if saved == nil {
+			delete(tasks, taskID)
+			continue
+		}
+		if current, ok := tasks[taskID]; ok { // keep pointers held by callers valid
+			*current = *saved
+			continue
+		}
+		tasks[taskID] = saved
+	}
+	if undo.preemptions < len(preemptionLog) {
+		preemptionLog = preemptionLog[:undo.preemptions]
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFailedScheduleTaskRollsBack(t *testing.T) {
+	setupState(t, "dev1")
+	// the first displaced task is re-placed after the manual task, the second can't be before its deadline
+	// and can't be cancelled as another task depends on it
+	first := newTestTask("a", "auto", testStart.Add(time.Hour), 30*time.Minute, "dev1")
+	placeTestTask(first)
+	second := newTestTask("b", "auto", testStart.Add(time.Hour+45*time.Minute), 30*time.Minute, "dev1")
+	second.Deadline = testStart.Add(3 * time.Hour)
+	placeTestTask(second)
+	dependent := newTestTask("c", "auto", testStart.Add(5*time.Hour), 30*time.Minute, "dev1")
+	dependent.Dependencies = []Dependency{{TaskID: second.ID}}
+	placeTestTask(dependent)
+	manual := newTestTask("m", "manual", testStart.Add(time.Hour), 90*time.Minute, "dev1")
+	tasks[manual.ID] = manual
+	before := snapshotState()
+
+	err := scheduleTask(manual, "wait")
+	if asAPIError(err, codeInternal).Code != codeDisplacementFailed {
+		t.Fatalf("scheduling the manual task returned %v, want %s", err, codeDisplacementFailed)
+	}
+	if len(undoLogs) != 0 {
+		t.Fatalf("%d undo logs left after scheduling", len(undoLogs))
+	}
+	if after := snapshotState(); !reflect.DeepEqual(before, after) {
+		t.Fatalf("state after the failed attempt differs:\n%+v\nwant\n%+v", after.tasks, before.tasks)
+	}
+	if tasks[first.ID] != first || !first.StartDatetime.Equal(testStart.Add(time.Hour)) || !schedule["dev1"].contains(first.ID) {
+		t.Fatalf("re-placed task wasn't moved back to its slot: %+v", first)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// whiteListEntry is a whitelist timespan optionally restricted to weekdays or dates:
+// "00:00-08:00", "Sat,Sun 00:00-08:00", "Mon-Fri 22:00-02:00", "2026-12-24..2026-12-26 10:00-12:00",
+// "2026-12-31 blocked"; blocked entries forbid tasks on matching days (all day if there is no timespan)
+type whiteListEntry struct {
+	Span     timeSpan
+	AllDay   bool
+	Weekdays map[time.Weekday]bool // any day if empty
+	Dates    [][2]time.Time        // inclusive date ranges; any date if empty
+	Blocked  bool
+}
+
+// interval is a concrete time interval, e.g. a whitelist window on a given day
+type interval struct {
+	Start time.Time
+	End   time.Time
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseWeekday(name string) (time.Weekday, error) {
+	weekday, ok := weekdayNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown weekday %s", name)
+	}
+	return weekday, nil
+}
+
+// parseWeekdays parses comma separated weekdays and ranges like "Mon-Fri"; ranges may wrap around Sunday
+func parseWeekdays(selector string) (map[time.Weekday]bool, error) {
+	weekdays := make(map[time.Weekday]bool)
+	for _, part := range strings.Split(selector, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := parseWeekday(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = parseWeekday(bounds[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		for day := first; ; day = (day + 1) % 7 {
+			weekdays[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	return weekdays, nil
+}
+
+// parseDates parses comma separated dates and ranges like "2026-12-24..2026-12-26"
+func parseDates(selector string) ([][2]time.Time, error) {
+	dates := [][2]time.Time{}
+	for _, part := range strings.Split(selector, ",") {
+		bounds := strings.SplitN(part, "..", 2)
+		first, err := time.Parse("2006-01-02", bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = time.Parse("2006-01-02", bounds[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		if last.Before(first) {
+			return nil, fmt.Errorf("date range %s ends before it starts", part)
+		}
+		dates = append(dates, [2]time.Time{first, last})
+	}
+	return dates, nil
+}
+
+func parseTimeSpan(timeSpanString string) (timeSpan, error) {
+	timeSpanSlice := strings.Split(timeSpanString, "-")
+	if len(timeSpanSlice) != 2 {
+		return timeSpan{}, fmt.Errorf("invalid timespan %s", timeSpanString)
+	}
+	start, err := time.Parse("15:04", timeSpanSlice[0])
+	if err != nil {
+		return timeSpan{}, err
+	}
+	end, err := time.Parse("15:04", timeSpanSlice[1])
+	if err != nil {
+		return timeSpan{}, err
+	}
+	if start.After(end) {
+		end = end.Add(time.Hour * 24)
+	}
+	return timeSpan{Start: start, End: end}, nil
+}
+
+func parseWhiteListEntry(entryString string) (whiteListEntry, error) {
+	entry := whiteListEntry{}
+	fields := strings.Fields(entryString)
+	if len(fields) > 0 && strings.ToLower(fields[len(fields)-1]) == "blocked" {
+		entry.Blocked = true
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) > 0 && strings.Contains(fields[len(fields)-1], ":") {
+		span, err := parseTimeSpan(fields[len(fields)-1])
+		if err != nil {
+			return entry, err
+		}
+		entry.Span = span
+		fields = fields[:len(fields)-1]
+	} else {
+		entry.AllDay = true
+	}
+	switch {
+	case len(fields) > 1:
+		return entry, fmt.Errorf("invalid whitelist entry %q", entryString)
+	case len(fields) == 1 && fields[0][0] >= '0' && fields[0][0] <= '9':
+		dates, err := parseDates(fields[0])
+		if err != nil {
+			return entry, err
+		}
+		entry.Dates = dates
+	case len(fields) == 1:
+		weekdays, err := parseWeekdays(fields[0])
+		if err != nil {
+			return entry, err
+		}
+		entry.Weekdays = weekdays
+	case entry.AllDay && !entry.Blocked:
+		return entry, fmt.Errorf("invalid whitelist entry %q", entryString)
+	}
+	return entry, nil
+}
+
+func (e whiteListEntry) matchesDay(day time.Time) bool {
+	if len(e.Weekdays) > 0 && !e.Weekdays[day.Weekday()] {
+		return false
+	}
+	if len(e.Dates) == 0 {
+		return true
+	}
+	date := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	for _, dates := range e.Dates {
+		if !date.Before(dates[0]) && !date.After(dates[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// on returns the entry's interval on the day; windows crossing midnight end the next day
+func (e whiteListEntry) on(day time.Time) interval {
+	if e.AllDay {
+		return interval{Start: day, End: day.AddDate(0, 0, 1)}
+	}
+	endDay := day.Day()
+	if e.Span.End.Day() != e.Span.Start.Day() {
+		endDay++
+	}
+	return interval{
+		Start: time.Date(day.Year(), day.Month(), day.Day(), e.Span.Start.Hour(), e.Span.Start.Minute(), 0, 0, day.Location()),
+		End:   time.Date(day.Year(), day.Month(), endDay, e.Span.End.Hour(), e.Span.End.Minute(), 0, 0, day.Location()),
+	}
+}
+
+// zoneWindows lists concrete whitelisted windows and blocked intervals of the zone on days around from-to;
+// days and timespans are in the zone timezone, so windows keep their local time across DST transitions
+func zoneWindows(zone string, from time.Time, to time.Time) ([]interval, []interval) {
+	windows, blocked := []interval{}, []interval{}
+	for day := startOfDay(from.In(zoneLocation(zone))).AddDate(0, 0, -1); !day.After(to); day = day.AddDate(0, 0, 1) {
+		for _, entry := range config.WhiteList[zone] {
+			if !entry.matchesDay(day) {
+				continue
+			}
+			if entry.Blocked {
+				blocked = append(blocked, entry.on(day))
+			} else {
+				windows = append(windows, entry.on(day))
+			}
+		}
+	}
+	return windows, blocked
+}
+
+// checkWhiteList checks that the task overlaps a whitelisted window of the zone and no blocked interval
+func checkWhiteList(zone string, start time.Time, end time.Time) error {
+	windows, blocked := zoneWindows(zone, start, end)
+	for _, span := range blocked {
+		if overlap(start, end, span.Start, span.End) {
+			return &APIError{Code: codeWindowBlocked, Message: fmt.Sprintf("zone %s is blocked %v-%v", zone, span.Start, span.End), Zone: zone}
+		}
+	}
+	for _, window := range windows {
+		if overlap(start, end, window.Start, window.End) {
+			return nil
+		}
+	}
+	return &APIError{Code: codeOutsideWhitelist, Message: fmt.Sprintf("does not match any timespan in zone: %s", zone), Zone: zone}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWhiteListEntry(t *testing.T) {
+	day := func(date string) time.Time {
+		parsed, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	cases := []struct {
+		entry    string
+		span     string // start-end, "+1" when the end is the next day; empty for whole days
+		weekdays []time.Weekday
+		dates    [][2]time.Time
+		blocked  bool
+		err      bool
+	}{
+		{entry: "00:00-08:00", span: "00:00-08:00"},
+		{entry: "22:00-02:00", span: "22:00-02:00+1"},
+		{entry: "Sat,Sun 00:00-08:00", span: "00:00-08:00", weekdays: []time.Weekday{time.Saturday, time.Sunday}},
+		{entry: "Mon-Wed 10:00-12:00", span: "10:00-12:00", weekdays: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday}},
+		{entry: "fri-mon 22:00-02:00", span: "22:00-02:00+1", weekdays: []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday}},
+		{entry: "Sun", weekdays: []time.Weekday{time.Sunday}},
+		{entry: "2026-12-24..2026-12-26 10:00-12:00", span: "10:00-12:00", dates: [][2]time.Time{{day("2026-12-24"), day("2026-12-26")}}},
+		{entry: "2026-12-24,2026-12-31 10:00-12:00", span: "10:00-12:00", dates: [][2]time.Time{{day("2026-12-24"), day("2026-12-24")}, {day("2026-12-31"), day("2026-12-31")}}},
+		{entry: "2026-12-31 blocked", dates: [][2]time.Time{{day("2026-12-31"), day("2026-12-31")}}, blocked: true},
+		{entry: "Sat 10:00-12:00 blocked", span: "10:00-12:00", weekdays: []time.Weekday{time.Saturday}, blocked: true},
+		{entry: "blocked", blocked: true},
+		{entry: "", err: true},
+		{entry: "10:00", err: true},
+		{entry: "25:00-26:00", err: true},
+		{entry: "Funday 10:00-12:00", err: true},
+		{entry: "Mon Tue 10:00-12:00", err: true},
+		{entry: "2026-12-26..2026-12-24 10:00-12:00", err: true},
+		{entry: "2026-13-01 blocked", err: true},
+	}
+	for _, c := range cases {
+		t.Run(c.entry, func(t *testing.T) {
+			entry, err := parseWhiteListEntry(c.entry)
+			if c.err {
+				if err == nil {
+					t.Fatalf("parsed %+v, want an error", entry)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			span := ""
+			if !entry.AllDay {
+				span = entry.Span.Start.Format("15:04") + "-" + entry.Span.End.Format("15:04")
+				if entry.Span.End.Day() != entry.Span.Start.Day() {
+					span += "+1"
+				}
+			}
+			if span != c.span {
+				t.Fatalf("timespan is %q, want %q", span, c.span)
+			}
+			weekdays := map[time.Weekday]bool{}
+			for _, weekday := range c.weekdays {
+				weekdays[weekday] = true
+			}
+			if len(entry.Weekdays) != len(weekdays) || (len(weekdays) > 0 && !reflect.DeepEqual(entry.Weekdays, weekdays)) {
+				t.Fatalf("weekdays are %v, want %v", entry.Weekdays, weekdays)
+			}
+			if len(entry.Dates) != len(c.dates) || (len(c.dates) > 0 && !reflect.DeepEqual(entry.Dates, c.dates)) {
+				t.Fatalf("dates are %v, want %v", entry.Dates, c.dates)
+			}
+			if entry.Blocked != c.blocked {
+				t.Fatalf("blocked is %v, want %v", entry.Blocked, c.blocked)
+			}
+		})
+	}
+}
+
+func TestZoneWindows(t *testing.T) {
+	// testStart is Monday 2030-01-07; DST starts in Europe/Berlin on Sunday 2030-03-31 at 02:00
+	cases := []struct {
+		name     string
+		entries  []string
+		timezone string
+		from     string
+		to       string
+		windows  []string // start/end in RFC3339
+		blocked  []string
+	}{
+		{
+			name:    "every day",
+			entries: []string{"10:00-12:00"},
+			from:    "2030-01-07T00:00:00Z",
+			to:      "2030-01-08T00:00:00Z",
+			windows: []string{"2030-01-06T10:00:00Z/2030-01-06T12:00:00Z", "2030-01-07T10:00:00Z/2030-01-07T12:00:00Z", "2030-01-08T10:00:00Z/2030-01-08T12:00:00Z"},
+		},
+		{
+			name:    "weekend",
+			entries: []string{"Sat,Sun 00:00-08:00"},
+			from:    "2030-01-11T00:00:00Z",
+			to:      "2030-01-14T12:00:00Z",
+			windows: []string{"2030-01-12T00:00:00Z/2030-01-12T08:00:00Z", "2030-01-13T00:00:00Z/2030-01-13T08:00:00Z"},
+		},
+		{
+			name:    "crossing midnight",
+			entries: []string{"Mon-Fri 22:00-02:00"},
+			from:    "2030-01-07T00:00:00Z",
+			to:      "2030-01-08T12:00:00Z",
+			windows: []string{"2030-01-07T22:00:00Z/2030-01-08T02:00:00Z", "2030-01-08T22:00:00Z/2030-01-09T02:00:00Z"},
+		},
+		{
+			name:    "crossing midnight at the end of the month",
+			entries: []string{"23:00-01:00"},
+			from:    "2030-01-31T12:00:00Z",
+			to:      "2030-01-31T12:00:00Z",
+			windows: []string{"2030-01-30T23:00:00Z/2030-01-31T01:00:00Z", "2030-01-31T23:00:00Z/2030-02-01T01:00:00Z"},
+		},
+		{
+			name:    "dates",
+			entries: []string{"2030-01-08..2030-01-09 10:00-12:00"},
+			from:    "2030-01-07T00:00:00Z",
+			to:      "2030-01-12T00:00:00Z",
+			windows: []string{"2030-01-08T10:00:00Z/2030-01-08T12:00:00Z", "2030-01-09T10:00:00Z/2030-01-09T12:00:00Z"},
+		},
+		{
+			name:    "whole day blocked",
+			entries: []string{"00:00-23:59", "2030-01-08 blocked"},
+			from:    "2030-01-08T00:00:00Z",
+			to:      "2030-01-08T00:00:00Z",
+			windows: []string{"2030-01-07T00:00:00Z/2030-01-07T23:59:00Z", "2030-01-08T00:00:00Z/2030-01-08T23:59:00Z"},
+			blocked: []string{"2030-01-08T00:00:00Z/2030-01-09T00:00:00Z"},
+		},
+		{
+			name:    "timespan blocked",
+			entries: []string{"08:00-18:00", "Tue 12:00-13:00 blocked"},
+			from:    "2030-01-08T00:00:00Z",
+			to:      "2030-01-08T00:00:00Z",
+			windows: []string{"2030-01-07T08:00:00Z/2030-01-07T18:00:00Z", "2030-01-08T08:00:00Z/2030-01-08T18:00:00Z"},
+			blocked: []string{"2030-01-08T12:00:00Z/2030-01-08T13:00:00Z"},
+		},
+		{
+			name:     "local days across DST",
+			entries:  []string{"01:00-04:00"},
+			timezone: "Europe/Berlin",
+			from:     "2030-03-31T00:00:00+01:00",
+			to:       "2030-04-01T00:00:00+02:00",
+			windows: []string{
+				"2030-03-30T01:00:00+01:00/2030-03-30T04:00:00+01:00",
+				"2030-03-31T01:00:00+01:00/2030-03-31T04:00:00+02:00",
+				"2030-04-01T01:00:00+02:00/2030-04-01T04:00:00+02:00",
+			},
+		},
+		{
+			name:     "local days crossing midnight across DST",
+			entries:  []string{"Sat 22:00-06:00"},
+			timezone: "Europe/Berlin",
+			from:     "2030-03-30T12:00:00Z",
+			to:       "2030-03-31T12:00:00Z",
+			windows:  []string{"2030-03-30T22:00:00+01:00/2030-03-31T06:00:00+02:00"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			setupState(t)
+			config.WhiteListRaw = map[string][]string{"dev1": c.entries}
+			config.TimezonesRaw = map[string]string{}
+			if c.timezone != "" {
+				config.TimezonesRaw["dev1"] = c.timezone
+			}
+			if err := loadWhiteList(); err != nil {
+				t.Fatal(err)
+			}
+			if err := loadTimezones(); err != nil {
+				t.Fatal(err)
+			}
+			from, err := time.Parse(time.RFC3339, c.from)
+			if err != nil {
+				t.Fatal(err)
+			}
+			to, err := time.Parse(time.RFC3339, c.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			windows, blocked := zoneWindows("dev1", from, to)
+			assertIntervals(t, "windows", windows, c.windows)
+			assertIntervals(t, "blocked", blocked, c.blocked)
+		})
+	}
+}
+
+func assertIntervals(t *testing.T, name string, got []interval, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s are %v, want %v", name, got, want)
+	}
+	for i, w := range want {
+		bounds := strings.SplitN(w, "/", 2)
+		start, err := time.Parse(time.RFC3339, bounds[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		end, err := time.Parse(time.RFC3339, bounds[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got[i].Start.Equal(start) || !got[i].End.Equal(end) {
+			t.Fatalf("%s[%d] is %v-%v, want %v-%v", name, i, got[i].Start, got[i].End, start, end)
+		}
+	}
+}